@@ -1,61 +1,363 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
+	"log/slog"
 	"mm/pkg/alpha"
 	"mm/pkg/bn"
+	"mm/pkg/journal"
+	"mm/pkg/paper"
+	"mm/pkg/report"
+	"mm/pkg/risk"
+	"mm/pkg/store"
+	"mm/pkg/sweep"
+	"mm/pkg/x10"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+func newVenue(params *alpha.Params) alpha.Venue {
+	switch params.Venue {
+	case "", "bn":
+		b, err := bn.NewBinance(params)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Binance %s: %s\n", cmp.Or(params.Profile, "mainnet"), b.Profile().Rest)
+		return b
+	case "x10":
+		x, err := x10.NewExtended(params)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Extended %s: %s\n", cmp.Or(params.Profile, "mainnet"), x.Profile().Rest)
+		return x
+	}
+
+	log.Fatalf("unknown venue %q", params.Venue)
+	return nil
+}
+
+// replayFeed swaps the live kline stream of venue for the one recorded in
+// path. Unless params pin an end time, warm-up history ends where the
+// recording starts.
+func replayFeed(params *alpha.Params, venue alpha.Venue, path string, speed float64) alpha.Venue {
+	if params.EndTime == "" {
+		start, err := journal.Start(path, "kline")
+		if err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		params.EndTime = start.UTC().Format(time.RFC3339)
+	}
+
+	parse := bn.ParseKline
+	if params.Venue == "x10" {
+		parse = x10.ParseKline
+	}
+
+	return &journal.Feed{Venue: venue, Path: path, Speed: speed, Parse: parse}
+}
+
+func loadCandles(params *alpha.Params, venue alpha.Venue, cacheDir string, isOffline bool, archivePath string) []alpha.Candle {
+	var candles []alpha.Candle
+	switch {
+	case archivePath != "":
+		fmt.Printf("Importing data from %s...\n", archivePath)
+		imported, err := bn.ImportKlines(archivePath)
+		if err != nil {
+			log.Fatalf("import archive: %v", err)
+		}
+		candles, err = store.Select(imported, params.BarsCount, params.EndTime)
+		if err != nil {
+			log.Fatalf("import archive: %v", err)
+		}
+	case isOffline:
+		fmt.Printf("Reading cached data for %s (%s, limit=%d)...\n", params.Symbol, params.Interval, params.BarsCount)
+		cache := store.New(cacheDir)
+		var err error
+		candles, err = cache.Read(params.Venue, params.Symbol, params.Interval, params.BarsCount, params.EndTime)
+		if err != nil {
+			log.Fatalf("read cache: %v", err)
+		}
+	case cacheDir != "":
+		fmt.Printf("Fetching data for %s (%s, limit=%d) via %s...\n", params.Symbol, params.Interval, params.BarsCount, cacheDir)
+		cache := store.New(cacheDir)
+		var err error
+		candles, err = cache.Fill(venue, params.Venue, params.Symbol, params.Interval, params.BarsCount, params.EndTime)
+		if err != nil {
+			log.Fatalf("fill cache: %v", err)
+		}
+	default:
+		fmt.Printf("Fetching data for %s (%s, limit=%d)...\n", params.Symbol, params.Interval, params.BarsCount)
+		var err error
+		candles, err = venue.FetchKlines(params.Symbol, params.Interval, params.BarsCount, params.EndTime)
+		if err != nil {
+			log.Fatalf("fetch klines: %v", err)
+		}
+	}
+	if len(candles) == 0 {
+		log.Fatalf("no candles for %s %s", params.Symbol, params.Interval)
+	}
+	fmt.Printf("Fetched %d bars\n", len(candles))
+
+	return candles
+}
+
+// handleApplyError pulls every resting order after a failed requote so no
+// stale quote is left on the book, and reports whether the session must stop.
+func handleApplyError(venue alpha.Venue, err error) bool {
+	slog.Error("Apply", "err", err)
+
+	if err := venue.Cancel(); err != nil {
+		slog.Error("Cancel", "err", err)
+	}
+
+	var fatal interface{ Fatal() bool }
+	return errors.As(err, &fatal) && fatal.Fatal()
+}
+
+func runSweep(params *alpha.Params, candles []alpha.Candle, ranges []sweep.Range, outFile string) {
+	results, err := sweep.Run(params, candles, ranges)
+	if err != nil {
+		log.Fatalf("sweep: %v", err)
+	}
+
+	f, err := os.Create(outFile)
+	if err != nil {
+		log.Fatalf("sweep: %v", err)
+	}
+	defer f.Close()
+
+	if err := sweep.WriteCSV(f, ranges, results); err != nil {
+		log.Fatalf("sweep: %v", err)
+	}
+
+	fmt.Printf("Sweep: %d combinations written to %s\n", len(results), outFile)
+	for i, res := range results[:min(5, len(results))] {
+		fmt.Printf("#%d %v net %.2f sharpe %.2f maxDD %.2f trades %d\n",
+			i+1, res.Values, res.Report.NetPnL, res.Report.Sharpe, res.Report.MaxDrawdown, res.Report.Trades)
+	}
+}
+
+func runWalkForward(params *alpha.Params, candles []alpha.Candle, ranges []sweep.Range, inBars, outBars int, outFile string) {
+	wr, err := sweep.WalkForward(params, candles, ranges, inBars, outBars)
+	if err != nil {
+		log.Fatalf("walk-forward: %v", err)
+	}
+
+	f, err := os.Create(outFile)
+	if err != nil {
+		log.Fatalf("walk-forward: %v", err)
+	}
+	defer f.Close()
+
+	if err := sweep.WriteFoldsCSV(f, ranges, wr.Folds); err != nil {
+		log.Fatalf("walk-forward: %v", err)
+	}
+
+	fmt.Printf("Walk-forward: %d folds written to %s\n", len(wr.Folds), outFile)
+	fmt.Println("Stitched out-of-sample:")
+	wr.Report.Print(os.Stdout)
+	for _, s := range wr.Stability {
+		fmt.Printf("%s: mean %.4g, std %.4g, range [%.4g, %.4g], changed %d/%d folds\n",
+			s.Field, s.Mean, s.StdDev, s.Min, s.Max, s.Changes, max(len(wr.Folds)-1, 0))
+	}
+}
+
 func main() {
+	var ranges []sweep.Range
+
 	paramsFile := flag.String("p", "params.json", "Strategy parameters")
 	showTrades := flag.Bool("s", false, "Show trades")
 	isTesting := flag.Bool("t", false, "Backtest mode")
+	cacheDir := flag.String("c", "data", "Candle cache directory, empty to disable")
+	isOffline := flag.Bool("o", false, "Offline backtest from the candle cache only")
+	archivePath := flag.String("f", "", "Backtest from a Binance kline archive file or directory")
+	flag.Func("sweep", "Sweep a param as field=from:to:step or field=v1,v2 (repeatable)", func(spec string) error {
+		r, err := sweep.ParseRange(spec)
+		ranges = append(ranges, r)
+		return err
+	})
+	sweepOut := flag.String("out", "sweep.csv", "Sweep result table")
+	wfIn := flag.Int("wf-in", 0, "Walk-forward in-sample bars, enables walk-forward with -sweep")
+	wfOut := flag.Int("wf-out", 0, "Walk-forward out-of-sample bars")
+	profile := flag.String("profile", "", "Venue profile: mainnet, testnet or custom, overrides params")
+	isPaper := flag.Bool("paper", false, "Paper-trade live on the real-time feed")
+	statePath := flag.String("state", "paper.gob", "Paper-trading state file")
+	isShadow := flag.Bool("shadow", false, "Trade live and compare against a paper engine on the same quotes")
+	recordPath := flag.String("record", "", "Record raw websocket frames to a gzip journal")
+	replayPath := flag.String("replay", "", "Paper-trade a recorded journal instead of the live feed")
+	speed := flag.Float64("speed", 1, "Replay speed multiplier, 0 for no waiting")
 	flag.Parse()
 
 	params := alpha.LoadParams(*paramsFile)
+	if *profile != "" {
+		params.Profile = *profile
+	}
 	fmt.Printf("Params loaded: %+v\n", params)
 
-	strategy := alpha.NewMmStrat(params)
-	paper := alpha.NewPaperEngine()
-
-	fmt.Printf("Fetching data for %s (%s, limit=%d)...\n", params.Symbol, params.Interval, params.BarsCount)
-	candles := bn.FetchKlines(params.Symbol, params.Interval, params.BarsCount, params.EndTime)
-	barsCount := params.BarsCount - 1 // ignore last, incomplete bar
-	for i := range barsCount {
-		c := candles[i]
-		fills := paper.ApplyFills(c)
-		ok, quote := strategy.Process(c, paper.Inventory())
+	venue := newVenue(params)
+	if *recordPath != "" {
+		recorder, ok := venue.(interface{ SetRecorder(journal.Recorder) })
 		if !ok {
-			continue
+			log.Fatalf("venue %q cannot record", params.Venue)
+		}
+		w, err := journal.Create(*recordPath)
+		if err != nil {
+			log.Fatalf("record: %v", err)
 		}
-		row := paper.FinalizeCandle(c, quote, fills)
+		defer w.Close()
+		recorder.SetRecorder(w)
+	}
+	switch {
+	case *isPaper && *isShadow, *replayPath != "" && *isShadow:
+		log.Fatal("-shadow is exclusive with -paper and -replay")
+	case *replayPath != "":
+		venue = paper.NewVenue(replayFeed(params, venue, *replayPath, *speed), params, "")
+	case *isPaper:
+		venue = paper.NewVenue(venue, params, *statePath)
+	case *isShadow:
+		venue = paper.NewShadow(venue, params)
+	}
+	trader := venue
+	if risk.LimitsFrom(params).Enabled() {
+		venue = risk.New(venue, params)
+	}
+	strategy := alpha.NewMmStrat(params)
+	pe := alpha.NewPaperEngine(params)
+
+	candles := loadCandles(params, venue, *cacheDir, *isOffline, *archivePath)
+	barsCount := len(candles) - 1 // ignore last, incomplete bar
+
+	if len(ranges) > 0 && *wfIn > 0 {
+		runWalkForward(params, candles[:barsCount], ranges, *wfIn, *wfOut, *sweepOut)
+		return
+	}
+	if len(ranges) > 0 {
+		runSweep(params, candles[:barsCount], ranges, *sweepOut)
+		return
+	}
+
+	alpha.Backtest(strategy, pe, candles[:barsCount], func(row alpha.ResultRow, fills []alpha.Trade) {
 		if *showTrades && len(fills) > 0 {
 			fmt.Printf("\n%v\n%v\n---", row, fills)
 		}
+	})
+
+	report.FromPaper(pe, params.Interval).Print(os.Stdout)
+
+	if *isTesting || *isOffline || *archivePath != "" {
+		return
 	}
 
-	finalPnL := paper.FinalPnL()
-	trades := paper.Trades()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	fmt.Printf("Final PnL: %.2f\n", finalPnL)
-	fmt.Printf("Trades executed: %d\n", len(trades))
+	runLive(ctx, params, venue, strategy, candles[barsCount], *showTrades) // use last as prev bar
 
-	if *isTesting {
-		return
+	switch v := trader.(type) {
+	case *paper.Venue:
+		fmt.Println("Paper trading:")
+		report.FromPaper(v.Engine(), params.Interval).Print(os.Stdout)
+	case *paper.Shadow:
+		v.Drift().Print(os.Stdout)
 	}
+}
+
+type session struct {
+	started  time.Time
+	bars     int
+	quotes   int
+	errors   int
+	fills    []alpha.Trade
+	startInv float64
+	endInv   float64
+}
+
+func (s *session) Print() {
+	fmt.Printf("Session: %s\n", time.Since(s.started).Round(time.Second))
+	fmt.Printf("Bars: %d, quotes: %d, apply errors: %d\n", s.bars, s.quotes, s.errors)
+
+	buys, sells, fees := 0, 0, 0.0
+	otherFees := map[string]float64{}
+	for _, fill := range s.fills {
+		if fill.Side == "buy" {
+			buys++
+		} else {
+			sells++
+		}
+		if fill.FeeAsset == "" {
+			fees += fill.Fee
+		} else {
+			otherFees[fill.FeeAsset] += fill.Fee
+		}
+	}
+	fmt.Printf("Fills: %d buys, %d sells, fees %.4f\n", buys, sells, fees)
+	for asset, fee := range otherFees {
+		fmt.Printf("Fees in %s: %g\n", asset, fee)
+	}
+	fmt.Printf("Inventory: %g -> %g\n", s.startInv, s.endInv)
+}
+
+// runLive quotes on every closed bar until ctx is cancelled, then pulls all
+// orders, optionally flattens and waits for the venue streams to stop.
+func runLive(ctx context.Context, params *alpha.Params, venue alpha.Venue, strategy *alpha.MmStrat, kline alpha.Candle, showTrades bool) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-	trader := bn.NewBinance(params)
-	trader.Sync(params.TradeSymbol)
+	if err := venue.Sync(ctx, params.TradeSymbol); err != nil {
+		log.Fatalf("sync: %v", err)
+	}
+
+	s := &session{
+		started:  time.Now(),
+		startInv: venue.Inventory(),
+	}
 
-	kline := candles[barsCount] // use last as prev bar
-	bn.WsKline(params.Symbol, func(c alpha.Candle) {
+	venue.WsKline(ctx, params.Symbol, params.Interval, func(c alpha.Candle) {
 		if c.Time > kline.Time {
-			ok, quote := strategy.Process(kline, trader.Inventory())
+			s.bars++
+			if fills := venue.Fills(); len(fills) > 0 {
+				s.fills = append(s.fills, fills...)
+				if showTrades {
+					fmt.Printf("\n%v\n%v\n---", kline, fills)
+				}
+			}
+			ok, quote := strategy.Process(kline, venue.Inventory())
 			if ok {
-				trader.Apply(quote)
+				s.quotes++
+				if err := venue.Apply(quote); err != nil {
+					s.errors++
+					if handleApplyError(venue, err) {
+						cancel(err)
+					}
+				}
 			}
 		}
 		kline = c
 	})
+
+	slog.Info("shutdown", "reason", context.Cause(ctx))
+
+	if err := venue.Cancel(); err != nil {
+		slog.Error("Cancel", "err", err)
+	}
+	if params.FlattenOnExit {
+		if err := venue.Flatten(); err != nil {
+			slog.Error("Flatten", "err", err)
+		}
+	}
+
+	venue.Wait()
+
+	s.fills = append(s.fills, venue.Fills()...)
+	s.endInv = venue.Inventory()
+	s.Print()
 }
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"mm/pkg/alpha"
+	"mm/pkg/bn"
+	"mm/pkg/bn/bntest"
+	"mm/pkg/journal"
+	"mm/pkg/paper"
+	"mm/pkg/risk"
+)
+
+const testBarMillis = 60_000
+
+// testCandles returns n one-minute bars oscillating around 60000.
+func testCandles(start int64, n int, phase float64) []alpha.Candle {
+	candles := make([]alpha.Candle, n)
+	for i := range candles {
+		px := 60000 + 300*math.Sin(phase+float64(i)/7)
+		open := 60000 + 300*math.Sin(phase+float64(i-1)/7)
+		candles[i] = alpha.Candle{
+			Time:   start + int64(i)*testBarMillis,
+			Open:   math.Round(open*10) / 10,
+			High:   math.Round(math.Max(open, px)*1.001*10) / 10,
+			Low:    math.Round(math.Min(open, px)*0.999*10) / 10,
+			Close:  math.Round(px*10) / 10,
+			Volume: 100,
+		}
+	}
+	return candles
+}
+
+func testParams(srv *bntest.Server) *alpha.Params {
+	return &alpha.Params{
+		Venue:          "bn",
+		Symbol:         "BTCUSDT",
+		Interval:       "1m",
+		BarsCount:      200,
+		MeSpan:         15,
+		EmaSpan:        15,
+		BaseSpread:     0.001,
+		InventoryLimit: 5,
+		LotSize:        1,
+		InventorySkewK: 0.2,
+		TrendSkewK:     0.4,
+		TrendBias:      0.5,
+		TradeSymbol:    "BTCUSDT",
+		TradeSz:        0.001,
+		PxPrecision:    1,
+		SzPrecision:    3,
+		MakerFee:       0.0002,
+		TakerFee:       0.0005,
+		FlattenOnExit:  true,
+		Profile:        "custom",
+		RestURL:        srv.URLs.Rest,
+		StreamURL:      srv.URLs.Stream,
+		WsAPIURL:       srv.URLs.WsAPI,
+	}
+}
+
+// liveSession is runLive quoting on a fake exchange in the background.
+type liveSession struct {
+	t       *testing.T
+	srv     *bntest.Server
+	history []alpha.Candle
+	params  *alpha.Params
+	venue   alpha.Venue
+	ticks   chan int64
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// tickingVenue reports the open time of every bar once runLive has handled
+// it, so tests can step through a session without sleeping.
+type tickingVenue struct {
+	alpha.Venue
+	ticks chan<- int64
+}
+
+func (v tickingVenue) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	v.Venue.WsKline(ctx, symbol, interval, func(c alpha.Candle) {
+		onTick(c)
+		select {
+		case v.ticks <- c.Time:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// startSession serves history from a fake exchange with its keys set, lets
+// setup adjust the params and wrap, if set, wrap the venue, then warms a
+// strategy up and runs runLive until stop. Sessions whose setup clears the
+// keys only wait for the kline stream.
+func startSession(t *testing.T, setup func(*alpha.Params), wrap func(alpha.Venue, *alpha.Params) alpha.Venue) *liveSession {
+	t.Helper()
+
+	history := testCandles(1_700_000_000_000, 200, 0)
+	srv := bntest.NewServer("BTCUSDT", "1m", history)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("BINANCE_API_KEY", srv.APIKey)
+	t.Setenv("BINANCE_SECRET_KEY", srv.SecretKey)
+	t.Setenv("BINANCE_ED25519_KEY", "")
+
+	params := testParams(srv)
+	if setup != nil {
+		setup(params)
+	}
+	venue := newVenue(params)
+	if wrap != nil {
+		venue = wrap(venue, params)
+	}
+	candles, err := venue.FetchKlines(params.Symbol, params.Interval, params.BarsCount, "")
+	if err != nil {
+		t.Fatalf("FetchKlines: %v", err)
+	}
+	if len(candles) != len(history) {
+		t.Fatalf("FetchKlines: got %d bars, want %d", len(candles), len(history))
+	}
+	strategy, last := warmUp(params, candles)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &liveSession{
+		t:       t,
+		srv:     srv,
+		history: history,
+		params:  params,
+		venue:   venue,
+		ticks:   make(chan int64, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		runLive(ctx, params, tickingVenue{venue, s.ticks}, strategy, last, false)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-s.done
+	})
+
+	keyed := os.Getenv("BINANCE_API_KEY") != ""
+	waitFor(t, "streams", func() bool {
+		klines, users := srv.Streams()
+		return klines == 1 && (users == 1 || !keyed)
+	})
+
+	return s
+}
+
+// warmUp runs a strategy over all candles but the last, which is returned
+// for the live loop to quote on first.
+func warmUp(params *alpha.Params, candles []alpha.Candle) (*alpha.MmStrat, alpha.Candle) {
+	barsCount := len(candles) - 1
+	strategy := alpha.NewMmStrat(params)
+	alpha.Backtest(strategy, alpha.NewPaperEngine(params), candles[:barsCount], nil)
+	return strategy, candles[barsCount]
+}
+
+// liveBars returns n bars continuing the history, the first repeating its
+// last bar as the opening tick.
+func (s *liveSession) liveBars(n int) []alpha.Candle {
+	last := s.history[len(s.history)-1]
+	return testCandles(last.Time, n, float64(len(s.history)-1))
+}
+
+// stream sends bars one by one, each once the session has requoted on the
+// one before.
+func (s *liveSession) stream(bars []alpha.Candle) {
+	s.t.Helper()
+
+	for _, c := range bars {
+		s.srv.Bar(c)
+		for handled := false; !handled; {
+			select {
+			case t := <-s.ticks:
+				handled = t == c.Time
+			case <-time.After(5 * time.Second):
+				s.t.Fatalf("bar %d not handled", c.Time)
+			}
+		}
+	}
+}
+
+// stop cancels the session and waits for runLive to shut down.
+func (s *liveSession) stop() {
+	s.t.Helper()
+
+	s.cancel()
+	select {
+	case <-s.done:
+	case <-time.After(10 * time.Second):
+		s.t.Fatal("runLive did not return after cancel")
+	}
+}
+
+// TestRunLive quotes the fake exchange through a stream of bars and checks
+// the fills, position and orders left behind once the session is stopped.
+func TestRunLive(t *testing.T) {
+	for _, transport := range []string{"rest", "ws"} {
+		t.Run(transport, func(t *testing.T) {
+			s := startSession(t, func(p *alpha.Params) { p.Transport = transport }, nil)
+			s.stream(s.liveBars(31))
+			s.stop()
+
+			fills := s.srv.Fills()
+			if len(fills) == 0 {
+				t.Fatal("no fills on the fake exchange")
+			}
+			makers := 0
+			for _, f := range fills {
+				if f.Maker {
+					makers++
+				}
+			}
+			if makers == 0 {
+				t.Error("no maker fills")
+			}
+			if open := s.srv.Open(); len(open) != 0 {
+				t.Errorf("%d orders left open after shutdown", len(open))
+			}
+			if pz := s.srv.Position(); pz != 0 {
+				t.Errorf("position %g left after flatten", pz)
+			}
+			if inv := s.venue.Inventory(); inv != 0 {
+				t.Errorf("venue inventory %g, want 0", inv)
+			}
+		})
+	}
+}
+
+// TestRunPaper paper-trades the fake exchange's feed without keys, then
+// checks a second session resumes from the saved state.
+func TestRunPaper(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "paper.gob")
+	noKeys := func(p *alpha.Params) {
+		t.Setenv("BINANCE_API_KEY", "")
+		t.Setenv("BINANCE_SECRET_KEY", "")
+		p.FlattenOnExit = false
+	}
+	s := startSession(t, noKeys, func(v alpha.Venue, p *alpha.Params) alpha.Venue {
+		return paper.NewVenue(v, p, statePath)
+	})
+	live := s.liveBars(31)
+	s.stream(live)
+	s.stop()
+
+	state := s.venue.(*paper.Venue).Engine().State()
+	if len(state.Trades) == 0 {
+		t.Fatal("no paper trades")
+	}
+	if n := len(state.Results); n == 0 || n > len(live)-1 {
+		t.Errorf("%d paper bars booked, want 1 to %d", n, len(live)-1)
+	}
+	if len(s.srv.Fills()) != 0 {
+		t.Error("paper mode traded on the exchange")
+	}
+
+	resumed := paper.NewVenue(newVenue(s.params), s.params, statePath)
+	if err := resumed.Sync(context.Background(), s.params.TradeSymbol); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if got := resumed.Inventory(); got != state.Inventory {
+		t.Errorf("resumed inventory %g, want %g", got, state.Inventory)
+	}
+	if got := len(resumed.Engine().Trades()); got != len(state.Trades) {
+		t.Errorf("resumed %d trades, want %d", got, len(state.Trades))
+	}
+}
+
+// TestRunShadow trades the fake exchange with a paper engine alongside and
+// checks both books saw the session.
+func TestRunShadow(t *testing.T) {
+	s := startSession(t, func(p *alpha.Params) { p.ShadowEvery = 10 }, func(v alpha.Venue, p *alpha.Params) alpha.Venue {
+		return paper.NewShadow(v, p)
+	})
+	s.stream(s.liveBars(31))
+	s.stop()
+
+	d := s.venue.(*paper.Shadow).Drift()
+	if d.Bars == 0 {
+		t.Fatal("no bars compared")
+	}
+	if d.RealBuys+d.RealSells == 0 || d.SimBuys+d.SimSells == 0 {
+		t.Errorf("filled real %g/%g, simulated %g/%g", d.RealBuys, d.RealSells, d.SimBuys, d.SimSells)
+	}
+	if d.RealInv != 0 || d.SimInv != 0 {
+		t.Errorf("inventory real %g, simulated %g after flatten", d.RealInv, d.SimInv)
+	}
+}
+
+// TestRecordReplay records the fake exchange's feed during a paper session
+// and replays the journal, which must reproduce the session's trades.
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl.gz")
+	w, err := journal.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noKeys := func(p *alpha.Params) {
+		t.Setenv("BINANCE_API_KEY", "")
+		p.FlattenOnExit = false
+	}
+	s := startSession(t, noKeys, func(v alpha.Venue, p *alpha.Params) alpha.Venue {
+		v.(*bn.Binance).SetRecorder(w)
+		return paper.NewVenue(v, p, "")
+	})
+	s.stream(s.liveBars(31))
+	s.stop()
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	recorded := s.venue.(*paper.Venue).Engine().Trades()
+	if len(recorded) == 0 {
+		t.Fatal("no trades in the recorded session")
+	}
+
+	replay := func() []alpha.Trade {
+		feed := &journal.Feed{Venue: newVenue(s.params), Path: path, Parse: bn.ParseKline}
+		venue := paper.NewVenue(feed, s.params, "")
+		strategy, last := warmUp(s.params, s.history)
+		runLive(context.Background(), s.params, venue, strategy, last, false)
+		return venue.Engine().Trades()
+	}
+	first, second := replay(), replay()
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("replays differ:\n%v\n%v", first, second)
+	}
+	// The live session may stop before handling the last recorded frames
+	if len(first) < len(recorded) || !reflect.DeepEqual(first[:len(recorded)], recorded) {
+		t.Errorf("replay does not reproduce the session:\n%v\n%v", first, recorded)
+	}
+}
+
+// TestRiskKillFile halts a live session on the fake exchange with the kill
+// file and checks nothing is quoted until the guard is reset.
+func TestRiskKillFile(t *testing.T) {
+	killFile := filepath.Join(t.TempDir(), "kill")
+	s := startSession(t, func(p *alpha.Params) {
+		p.FlattenOnExit = false
+		p.RiskFlatten = true
+		p.RiskKillFile = killFile
+	}, func(v alpha.Venue, p *alpha.Params) alpha.Venue {
+		return risk.New(v, p)
+	})
+	guard := s.venue.(*risk.Guard)
+
+	live := s.liveBars(41)
+	s.stream(live[:20])
+	if len(s.srv.Fills()) == 0 {
+		t.Fatal("no fills before the kill switch")
+	}
+
+	if err := os.WriteFile(killFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "halt", func() bool { return guard.Status().Halted })
+
+	for _, c := range live[20:] {
+		s.stream([]alpha.Candle{c})
+		if open := s.srv.Open(); len(open) != 0 {
+			t.Fatalf("%d orders quoted while halted", len(open))
+		}
+	}
+	if pz := s.srv.Position(); pz != 0 {
+		t.Errorf("position %g after halt, want flat", pz)
+	}
+
+	if err := guard.Reset(); err == nil {
+		t.Error("Reset succeeded with the kill file present")
+	}
+	os.Remove(killFile)
+	if err := guard.Reset(); err != nil {
+		t.Errorf("Reset: %v", err)
+	}
+	if guard.Status().Halted {
+		t.Error("still halted after reset")
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,17 @@
+package alpha
+
+// Backtest replays candles bar by bar through the strategy and the paper
+// engine, calling onBar (if set) for every quoted bar.
+func Backtest(strategy *MmStrat, paper *PaperEngine, candles []Candle, onBar func(ResultRow, []Trade)) {
+	for _, c := range candles {
+		fills := paper.ApplyFills(c)
+		ok, quote := strategy.Process(c, paper.Inventory())
+		if !ok {
+			continue
+		}
+		row := paper.FinalizeCandle(c, quote, fills)
+		if onBar != nil {
+			onBar(row, fills)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package alpha
+
+import (
+	"sort"
+	"strconv"
+)
+
+// MergeCandles returns the union of a and b ordered by open time. Bars with
+// the same open time are de-duplicated, the one from b wins.
+func MergeCandles(a, b []Candle) []Candle {
+	merged := make([]Candle, 0, len(a)+len(b))
+	merged = append(merged, a...)
+	merged = append(merged, b...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Time < merged[j].Time
+	})
+
+	n := 0
+	for _, c := range merged {
+		if n > 0 && merged[n-1].Time == c.Time {
+			merged[n-1] = c
+			continue
+		}
+		merged[n] = c
+		n++
+	}
+
+	return merged[:n]
+}
+
+var intervalUnits = map[byte]int64{
+	'm': 60_000,
+	'h': 3_600_000,
+	'd': 86_400_000,
+	'w': 604_800_000,
+	'M': 2_592_000_000,
+}
+
+// IntervalMillis converts a kline interval such as "1m", "4h" or "1d" to its
+// length in milliseconds, months counted as 30 days. Zero means unknown.
+func IntervalMillis(interval string) int64 {
+	if len(interval) < 2 {
+		return 0
+	}
+
+	unit, ok := intervalUnits[interval[len(interval)-1]]
+	if !ok {
+		return 0
+	}
+
+	n, err := strconv.ParseInt(interval[:len(interval)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+
+	return n * unit
+}
@@ -0,0 +1,114 @@
+package alpha
+
+import (
+	"log"
+	"math"
+	"math/rand"
+)
+
+type FillModel interface {
+	// Fill returns how much of a resting order trades during c.
+	Fill(order Order, c Candle) float64
+}
+
+func NewFillModel(params *Params) FillModel {
+	tick := math.Pow10(-params.PxPrecision)
+
+	switch params.FillModel {
+	case "", "touch":
+		return TouchFill{}
+	case "through":
+		return ThroughFill{Depth: float64(params.FillTicks) * tick}
+	case "prob":
+		if params.FillQueueVolume <= 0 {
+			log.Fatalf("NewFillModel: prob needs fillQueueVolume > 0, got %g", params.FillQueueVolume)
+		}
+		return &ProbFill{
+			Depth:       float64(params.FillTicks) * tick,
+			QueueVolume: params.FillQueueVolume,
+			rng:         rand.New(rand.NewSource(params.FillSeed)),
+		}
+	case "partial":
+		if params.FillParticipation <= 0 || params.FillParticipation > 1 {
+			log.Fatalf("NewFillModel: partial needs 0 < fillParticipation <= 1, got %g", params.FillParticipation)
+		}
+		return PartialFill{
+			Depth:         float64(params.FillTicks) * tick,
+			Participation: params.FillParticipation,
+		}
+	}
+
+	log.Fatalf("NewFillModel: unknown fill model %q", params.FillModel)
+	return nil
+}
+
+// TouchFill fills the whole order as soon as the bar trades at its price.
+type TouchFill struct{}
+
+func (TouchFill) Fill(order Order, c Candle) float64 {
+	if !tradedThrough(order, c, 0) {
+		return 0
+	}
+	return order.Size
+}
+
+// ThroughFill needs the bar to trade Depth beyond the order price, so being
+// at the back of the queue at the touch is never rewarded.
+type ThroughFill struct {
+	Depth float64
+}
+
+func (m ThroughFill) Fill(order Order, c Candle) float64 {
+	if !tradedThrough(order, c, m.Depth) {
+		return 0
+	}
+	return order.Size
+}
+
+// ProbFill fills with probability volume/(volume+QueueVolume) once the bar
+// trades Depth through the price, QueueVolume standing for the size resting
+// ahead of us. Runs are reproducible for a given seed.
+type ProbFill struct {
+	Depth       float64
+	QueueVolume float64
+	rng         *rand.Rand
+}
+
+func (m *ProbFill) Fill(order Order, c Candle) float64 {
+	if !tradedThrough(order, c, m.Depth) {
+		return 0
+	}
+
+	p := 1.0
+	if m.QueueVolume > 0 {
+		p = c.Volume / (c.Volume + m.QueueVolume)
+	}
+	if m.rng.Float64() >= p {
+		return 0
+	}
+	return order.Size
+}
+
+// PartialFill caps the filled size at Participation of the bar volume.
+type PartialFill struct {
+	Depth         float64
+	Participation float64
+}
+
+func (m PartialFill) Fill(order Order, c Candle) float64 {
+	if !tradedThrough(order, c, m.Depth) {
+		return 0
+	}
+
+	return min(order.Size, c.Volume*m.Participation)
+}
+
+func tradedThrough(order Order, c Candle, depth float64) bool {
+	switch order.Side {
+	case "buy":
+		return c.Low <= order.Price-depth
+	case "sell":
+		return c.High >= order.Price+depth
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package alpha
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFillModels(t *testing.T) {
+	buy := Order{Side: "buy", Price: 100, Size: 2}
+	sell := Order{Side: "sell", Price: 100, Size: 2}
+	bar := func(low, high, volume float64) Candle {
+		return Candle{Open: 100, High: high, Low: low, Close: 100, Volume: volume}
+	}
+
+	tests := []struct {
+		name   string
+		params Params
+		order  Order
+		c      Candle
+		want   float64
+	}{
+		{"touch at price", Params{FillModel: "touch"}, buy, bar(100, 101, 10), 2},
+		{"touch above bid", Params{FillModel: "touch"}, buy, bar(100.1, 101, 10), 0},
+		{"touch at ask", Params{FillModel: "touch"}, sell, bar(99, 100, 10), 2},
+
+		{"through at touch", Params{FillModel: "through", FillTicks: 2, PxPrecision: 1}, buy, bar(100, 101, 10), 0},
+		{"through one tick short", Params{FillModel: "through", FillTicks: 2, PxPrecision: 1}, buy, bar(99.9, 101, 10), 0},
+		{"through exactly N ticks", Params{FillModel: "through", FillTicks: 2, PxPrecision: 1}, buy, bar(99.8, 101, 10), 2},
+		{"through sell exactly N ticks", Params{FillModel: "through", FillTicks: 2, PxPrecision: 1}, sell, bar(99, 100.2, 10), 2},
+		{"through sell one tick short", Params{FillModel: "through", FillTicks: 2, PxPrecision: 1}, sell, bar(99, 100.1, 10), 0},
+
+		{"partial capped by volume", Params{FillModel: "partial", FillParticipation: 0.1}, buy, bar(99, 101, 5), 0.5},
+		{"partial whole order", Params{FillModel: "partial", FillParticipation: 0.5}, buy, bar(99, 101, 10), 2},
+		{"partial not traded", Params{FillModel: "partial", FillParticipation: 1}, buy, bar(100.1, 101, 100), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewFillModel(&tt.params).Fill(tt.order, tt.c); got != tt.want {
+				t.Errorf("Fill = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbFillSeed(t *testing.T) {
+	params := &Params{FillModel: "prob", FillQueueVolume: 10, FillSeed: 42}
+	order := Order{Side: "buy", Price: 100, Size: 1}
+
+	run := func() []float64 {
+		model := NewFillModel(params)
+		fills := make([]float64, 200)
+		for i := range fills {
+			fills[i] = model.Fill(order, Candle{High: 101, Low: 99, Volume: 10})
+		}
+		return fills
+	}
+
+	first := run()
+	if second := run(); !slices.Equal(first, second) {
+		t.Fatal("same seed gave different fills")
+	}
+
+	// Half the bar volume is queued ahead, so roughly half the bars fill
+	filled := 0
+	for _, f := range first {
+		switch f {
+		case 0:
+		case order.Size:
+			filled++
+		default:
+			t.Fatalf("prob fill of %g, want 0 or the whole order", f)
+		}
+	}
+	if filled < 60 || filled > 140 {
+		t.Errorf("%d of %d bars filled at p=0.5", filled, len(first))
+	}
+
+	if f := NewFillModel(params).Fill(order, Candle{High: 101, Low: 100.1, Volume: 10}); f != 0 {
+		t.Errorf("filled %g without trading through", f)
+	}
+}
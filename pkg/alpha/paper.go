@@ -7,10 +7,12 @@ type ResultRow struct {
 	Close         float64
 	Bid           float64
 	Ask           float64
-	Inventory     int
+	Inventory     float64
 	Signal        float64
 	Cash          float64
 	CumulativePnL float64
+	GrossPnL      float64
+	Fees          float64
 	BuyFillPrice  float64
 	HasBuyFill    bool
 	SellFillPrice float64
@@ -18,8 +20,12 @@ type ResultRow struct {
 }
 
 type PaperEngine struct {
-	inventory     int
+	fillModel     FillModel
+	makerFee      float64
+	takerFee      float64
+	inventory     float64
 	cash          float64
+	fees          float64
 	pendingOrders []Order
 	pnlHistory    []float64
 	trades        []Trade
@@ -27,8 +33,11 @@ type PaperEngine struct {
 	lastClose     float64
 }
 
-func NewPaperEngine() *PaperEngine {
+func NewPaperEngine(params *Params) *PaperEngine {
 	return &PaperEngine{
+		fillModel:     NewFillModel(params),
+		makerFee:      params.MakerFee,
+		takerFee:      params.TakerFee,
 		pendingOrders: make([]Order, 0),
 		pnlHistory:    make([]float64, 0),
 		trades:        make([]Trade, 0),
@@ -36,7 +45,7 @@ func NewPaperEngine() *PaperEngine {
 	}
 }
 
-func (pe *PaperEngine) Inventory() int {
+func (pe *PaperEngine) Inventory() float64 {
 	return pe.inventory
 }
 
@@ -47,42 +56,62 @@ func (pe *PaperEngine) ApplyFills(c Candle) []Trade {
 
 	fills := make([]Trade, 0, len(pe.pendingOrders))
 	for _, order := range pe.pendingOrders {
-		switch order.Side {
-		case "buy":
-			if c.Low <= order.Price {
-				pe.inventory += order.Size
-				pe.cash -= order.Price * float64(order.Size)
-				trade := Trade{
-					Side:  "buy",
-					Time:  c.Time,
-					Price: order.Price,
-					Size:  order.Size,
-				}
-				pe.trades = append(pe.trades, trade)
-				fills = append(fills, trade)
-			}
-		case "sell":
-			if c.High >= order.Price {
-				pe.inventory -= order.Size
-				pe.cash += order.Price * float64(order.Size)
-				trade := Trade{
-					Side:  "sell",
-					Time:  c.Time,
-					Price: order.Price,
-					Size:  order.Size,
-				}
-				pe.trades = append(pe.trades, trade)
-				fills = append(fills, trade)
-			}
+		// Quotes are post-only: one marketable at the open is rejected and,
+		// as live, rests again at the queue price, taken to be the open
+		if (order.Side == "buy" && order.Price >= c.Open) ||
+			(order.Side == "sell" && order.Price <= c.Open) {
+			order.Price = c.Open
 		}
+
+		size := pe.fillModel.Fill(order, c)
+		if size <= 0 {
+			continue
+		}
+
+		order.Size = size
+		fills = append(fills, pe.fill(order, c, false))
 	}
 
 	pe.pendingOrders = pe.pendingOrders[:0]
 	return fills
 }
 
+// Resting quotes pay (or earn, if negative) the maker fee, only Flatten
+// crosses the book and pays the taker fee.
+func (pe *PaperEngine) fill(order Order, c Candle, taker bool) Trade {
+	rate := pe.makerFee
+	if taker {
+		rate = pe.takerFee
+	}
+
+	notional := order.Price * order.Size
+	fee := notional * rate
+	if order.Side == "buy" {
+		pe.inventory += order.Size
+		pe.cash -= notional
+	} else {
+		pe.inventory -= order.Size
+		pe.cash += notional
+	}
+	pe.inventory = snapQty(pe.inventory)
+	pe.cash -= fee
+	pe.fees += fee
+
+	trade := Trade{
+		Side:  order.Side,
+		Time:  c.Time,
+		Price: order.Price,
+		Size:  order.Size,
+		Fee:   fee,
+		Taker: taker,
+	}
+	pe.trades = append(pe.trades, trade)
+
+	return trade
+}
+
 func (pe *PaperEngine) FinalizeCandle(c Candle, quote Quote, fills []Trade) ResultRow {
-	currentPnL := pe.cash + float64(pe.inventory)*c.Close
+	currentPnL := pe.cash + pe.inventory*c.Close
 	pe.pnlHistory = append(pe.pnlHistory, currentPnL)
 
 	signal := 0.0
@@ -102,6 +131,8 @@ func (pe *PaperEngine) FinalizeCandle(c Candle, quote Quote, fills []Trade) Resu
 		Signal:        signal,
 		Cash:          pe.cash,
 		CumulativePnL: currentPnL,
+		GrossPnL:      currentPnL + pe.fees,
+		Fees:          pe.fees,
 	}
 
 	for _, fill := range fills {
@@ -151,8 +182,14 @@ func (pe *PaperEngine) FinalizeCandle(c Candle, quote Quote, fills []Trade) Resu
 	return row
 }
 
-func (pe *PaperEngine) FinalPnL() float64 {
-	return pe.cash + float64(pe.inventory)*pe.lastClose
+// FinalPnL returns the marked-to-close PnL before and after fees.
+func (pe *PaperEngine) FinalPnL() (gross, net float64) {
+	net = pe.cash + pe.inventory*pe.lastClose
+	return net + pe.fees, net
+}
+
+func (pe *PaperEngine) Fees() float64 {
+	return pe.fees
 }
 
 func (pe *PaperEngine) PnLHistory() []float64 {
@@ -166,3 +203,59 @@ func (pe *PaperEngine) Trades() []Trade {
 func (pe *PaperEngine) Results() []ResultRow {
 	return pe.results
 }
+
+// CancelAll drops the resting quotes.
+func (pe *PaperEngine) CancelAll() {
+	pe.pendingOrders = pe.pendingOrders[:0]
+}
+
+// Flatten closes the inventory at the last close as a taker, reporting
+// whether there was anything to close.
+func (pe *PaperEngine) Flatten(t int64) (Trade, bool) {
+	if pe.inventory == 0 {
+		return Trade{}, false
+	}
+
+	order := Order{Side: "sell", Price: pe.lastClose, Size: pe.inventory, PlacedAt: t}
+	if pe.inventory < 0 {
+		order.Side = "buy"
+		order.Size = -pe.inventory
+	}
+	return pe.fill(order, Candle{Time: t, Close: pe.lastClose}, true), true
+}
+
+// PaperState is everything a PaperEngine needs to resume where it stopped.
+type PaperState struct {
+	Inventory     float64
+	Cash          float64
+	Fees          float64
+	LastClose     float64
+	PendingOrders []Order
+	PnLHistory    []float64
+	Trades        []Trade
+	Results       []ResultRow
+}
+
+func (pe *PaperEngine) State() PaperState {
+	return PaperState{
+		Inventory:     pe.inventory,
+		Cash:          pe.cash,
+		Fees:          pe.fees,
+		LastClose:     pe.lastClose,
+		PendingOrders: pe.pendingOrders,
+		PnLHistory:    pe.pnlHistory,
+		Trades:        pe.trades,
+		Results:       pe.results,
+	}
+}
+
+func (pe *PaperEngine) Restore(s PaperState) {
+	pe.inventory = s.Inventory
+	pe.cash = s.Cash
+	pe.fees = s.Fees
+	pe.lastClose = s.LastClose
+	pe.pendingOrders = append(pe.pendingOrders[:0], s.PendingOrders...)
+	pe.pnlHistory = append(pe.pnlHistory[:0], s.PnLHistory...)
+	pe.trades = append(pe.trades[:0], s.Trades...)
+	pe.results = append(pe.results[:0], s.Results...)
+}
@@ -0,0 +1,89 @@
+package alpha
+
+import "testing"
+
+// TestPaperFractionalInventory books a partial fill and checks the engine
+// holds the exact base quantity instead of whole lots.
+func TestPaperFractionalInventory(t *testing.T) {
+	params := &Params{FillModel: "partial", FillParticipation: 0.0001, TradeSz: 0.001, LotSize: 1}
+	pe := NewPaperEngine(params)
+
+	bid := Quote{Valid: true, BidActive: true, BidPrice: 100, BidSize: 0.001}
+	pe.FinalizeCandle(Candle{Close: 100.5}, bid, nil)
+	fills := pe.ApplyFills(Candle{Open: 100.5, High: 101, Low: 99, Close: 100, Volume: 5})
+	if len(fills) != 1 || fills[0].Size != 0.0005 {
+		t.Fatalf("fills %+v, want one buy of 0.0005", fills)
+	}
+	if inv := pe.Inventory(); inv != 0.0005 {
+		t.Errorf("inventory %g after partial buy, want 0.0005", inv)
+	}
+
+	ask := Quote{Valid: true, AskActive: true, AskPrice: 100, AskSize: 0.001}
+	pe.FinalizeCandle(Candle{Close: 99.5}, ask, fills)
+	pe.ApplyFills(Candle{Open: 99.5, High: 101, Low: 99, Close: 100, Volume: 100})
+	if inv := pe.Inventory(); inv != -0.0005 {
+		t.Errorf("inventory %g after selling a lot, want -0.0005", inv)
+	}
+
+	trade, ok := pe.Flatten(0)
+	if !ok || trade.Side != "buy" || trade.Size != 0.0005 {
+		t.Errorf("Flatten = %+v, want a buy of 0.0005", trade)
+	}
+	if inv := pe.Inventory(); inv != 0 {
+		t.Errorf("inventory %g after flatten, want 0", inv)
+	}
+}
+
+// TestPaperPostOnly quotes through the open, which live rejects and rests
+// again at the queue, so it must fill as a maker at the open if at all.
+func TestPaperPostOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		fills int
+	}{
+		{"touch", "touch", 1},
+		{"through", "through", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &Params{FillModel: tt.model, FillTicks: 10, PxPrecision: 1, MakerFee: 0.0002, TakerFee: 0.0005, TradeSz: 1, LotSize: 1}
+			pe := NewPaperEngine(params)
+
+			pe.FinalizeCandle(Candle{Close: 100}, Quote{Valid: true, BidActive: true, BidPrice: 101, BidSize: 1}, nil)
+			fills := pe.ApplyFills(Candle{Open: 100.5, High: 101, Low: 100, Close: 100.5, Volume: 10})
+			if len(fills) != tt.fills {
+				t.Fatalf("fills %+v, want %d", fills, tt.fills)
+			}
+			for _, f := range fills {
+				if f.Taker || f.Price != 100.5 || f.Fee != 100.5*0.0002 {
+					t.Errorf("fill %+v, want a maker buy at the open", f)
+				}
+			}
+		})
+	}
+}
+
+// TestSnapQty checks snapping only drops float noise and never rounds to
+// a lot, which is left to the venue when an order is submitted.
+func TestSnapQty(t *testing.T) {
+	sum := 0.0
+	for range 10 {
+		sum += 0.0001
+	}
+
+	tests := []struct {
+		q, want float64
+	}{
+		{sum, 0.001},
+		{0.00123, 0.00123},
+		{-0.0005, -0.0005},
+		{0.0005 - 0.001, -0.0005},
+	}
+	for _, tt := range tests {
+		if got := snapQty(tt.q); got != tt.want {
+			t.Errorf("snapQty(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 )
 
 type Params struct {
+	Venue          string  `json:"venue"`
 	Symbol         string  `json:"symbol"`
 	Interval       string  `json:"interval"`
 	EndTime        string  `json:"endTime"`
@@ -14,8 +15,8 @@ type Params struct {
 	MeSpan         int     `json:"meSpan"`
 	EmaSpan        int     `json:"emaSpan"`
 	BaseSpread     float64 `json:"baseSpread"`
-	InventoryLimit int     `json:"inventoryLimit"`
-	LotSize        int     `json:"lotSize"`
+	InventoryLimit int     `json:"inventoryLimit"` // lots
+	LotSize        int     `json:"lotSize"`        // lots
 	InventorySkewK float64 `json:"inventorySkewK"`
 	TrendSkewK     float64 `json:"trendSkewK"`
 	TrendBias      float64 `json:"trendBias"`
@@ -23,6 +24,47 @@ type Params struct {
 	TradeSz        float64 `json:"tradeSz"`
 	PxPrecision    int     `json:"pxPrecision"`
 	SzPrecision    int     `json:"szPrecision"`
+	MakerFee       float64 `json:"makerFee"`
+	TakerFee       float64 `json:"takerFee"`
+	FlattenOnExit  bool    `json:"flattenOnExit"`
+	RequoteTicks   int     `json:"requoteTicks"`
+	Transport      string  `json:"transport"`
+
+	Profile      string `json:"profile"`
+	RestURL      string `json:"restUrl"`
+	StreamURL    string `json:"streamUrl"`
+	WsAPIURL     string `json:"wsApiUrl"`
+	APIKeyEnv    string `json:"apiKeyEnv"`
+	SecretKeyEnv string `json:"secretKeyEnv"`
+
+	ShadowEvery       int     `json:"shadowEvery"`
+	ShadowMaxInvDiff  float64 `json:"shadowMaxInvDiff"`
+	ShadowMaxFillDiff float64 `json:"shadowMaxFillDiff"`
+	ShadowMaxPxBps    float64 `json:"shadowMaxPxBps"`
+	ShadowMaxPnLDiff  float64 `json:"shadowMaxPnLDiff"`
+
+	RiskMaxDailyLoss float64 `json:"riskMaxDailyLoss"`
+	RiskMaxDrawdown  float64 `json:"riskMaxDrawdown"`
+	RiskMaxPosition  float64 `json:"riskMaxPosition"`
+	RiskMaxNotional  float64 `json:"riskMaxNotional"`
+	RiskMaxOrderRate int     `json:"riskMaxOrderRate"`
+	RiskFlatten      bool    `json:"riskFlatten"`
+	RiskKillFile     string  `json:"riskKillFile"`
+	RiskAddr         string  `json:"riskAddr"`
+
+	FillModel         string  `json:"fillModel"`
+	FillTicks         int     `json:"fillTicks"`
+	FillSeed          int64   `json:"fillSeed"`
+	FillQueueVolume   float64 `json:"fillQueueVolume"`
+	FillParticipation float64 `json:"fillParticipation"`
+}
+
+// LotQty is the base quantity of one lot, TradeSz or 1 if unset.
+func (p *Params) LotQty() float64 {
+	if p.TradeSz <= 0 {
+		return 1
+	}
+	return p.TradeSz
 }
 
 func LoadParams(path string) *Params {
@@ -1,5 +1,17 @@
 package alpha
 
+import "math"
+
+// qtyEpsilon is far below any exchange lot; quantities closer than this
+// are the same.
+const qtyEpsilon = 1e-9
+
+// snapQty drops the binary rounding error that builds up when decimal sizes
+// are added, so a flat book is exactly zero.
+func snapQty(q float64) float64 {
+	return math.Round(q/qtyEpsilon) * qtyEpsilon
+}
+
 type Candle struct {
 	Time   int64
 	Open   float64
@@ -9,13 +21,15 @@ type Candle struct {
 	Volume float64
 }
 
+// Sizes and inventory are quantities of the base asset. They are rounded to
+// the exchange lot only when an order is submitted.
 type Quote struct {
 	Time      int64
 	BidPrice  float64
-	BidSize   int
+	BidSize   float64
 	BidActive bool
 	AskPrice  float64
-	AskSize   int
+	AskSize   float64
 	AskActive bool
 	Valid     bool
 }
@@ -23,13 +37,16 @@ type Quote struct {
 type Order struct {
 	Side     string
 	Price    float64
-	Size     int
+	Size     float64
 	PlacedAt int64
 }
 
 type Trade struct {
-	Side  string
-	Time  int64
-	Price float64
-	Size  int
+	Side     string
+	Time     int64
+	Price    float64
+	Size     float64
+	Fee      float64 // quote currency, unless FeeAsset is set
+	FeeAsset string  // asset the fee was charged in if not the quote currency
+	Taker    bool
 }
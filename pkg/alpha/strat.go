@@ -159,8 +159,8 @@ type MmStrat struct {
 	meIndi         *MeIndicator
 	emaIndi        *EmaIndicator
 	BaseSpread     float64
-	InventoryLimit int
-	LotSize        int
+	InventoryLimit float64 // base quantity, 0 for no limit
+	LotSize        float64 // base quantity quoted per side
 	InventorySkewK float64
 	TrendSkewK     float64
 	TrendBias      float64
@@ -171,15 +171,15 @@ func NewMmStrat(params *Params) *MmStrat {
 		meIndi:         NewMeIndicator(params.MeSpan),
 		emaIndi:        NewEmaIndicator(params.EmaSpan),
 		BaseSpread:     params.BaseSpread,
-		InventoryLimit: params.InventoryLimit,
-		LotSize:        params.LotSize,
+		InventoryLimit: float64(params.InventoryLimit) * params.LotQty(),
+		LotSize:        float64(params.LotSize) * params.LotQty(),
 		InventorySkewK: params.InventorySkewK,
 		TrendSkewK:     params.TrendSkewK,
 		TrendBias:      params.TrendBias,
 	}
 }
 
-func (s *MmStrat) Process(c Candle, inventory int) (bool, Quote) {
+func (s *MmStrat) Process(c Candle, inventory float64) (bool, Quote) {
 	emaOk := s.emaIndi.Process(c)
 	meOk := s.meIndi.Process(c)
 
@@ -210,9 +210,9 @@ func (s *MmStrat) Process(c Candle, inventory int) (bool, Quote) {
 	ask := mid + halfSpread
 
 	if s.InventoryLimit > 0 && s.InventorySkewK != 0 {
-		invDenominator := float64(s.InventoryLimit)
+		invDenominator := s.InventoryLimit
 		if invDenominator != 0 {
-			invFrac := float64(inventory) / invDenominator
+			invFrac := inventory / invDenominator
 			invFrac = clampFloat(invFrac, -1, 1)
 			invShift := s.InventorySkewK * invFrac * halfSpread
 			bid -= invShift
@@ -236,13 +236,13 @@ func (s *MmStrat) Process(c Candle, inventory int) (bool, Quote) {
 	quote.AskPrice = ask
 	quote.Valid = true
 
-	if s.InventoryLimit == 0 || absInt(inventory+s.LotSize) <= s.InventoryLimit {
+	if s.InventoryLimit == 0 || math.Abs(inventory+s.LotSize) <= s.InventoryLimit+qtyEpsilon {
 		quote.BidActive = true
 	} else {
 		quote.BidPrice = math.NaN()
 	}
 
-	if s.InventoryLimit == 0 || absInt(inventory-s.LotSize) <= s.InventoryLimit {
+	if s.InventoryLimit == 0 || math.Abs(inventory-s.LotSize) <= s.InventoryLimit+qtyEpsilon {
 		quote.AskActive = true
 	} else {
 		quote.AskPrice = math.NaN()
@@ -251,13 +251,6 @@ func (s *MmStrat) Process(c Candle, inventory int) (bool, Quote) {
 	return true, quote
 }
 
-func absInt(v int) int {
-	if v < 0 {
-		return -v
-	}
-	return v
-}
-
 func clampFloat(v, min, max float64) float64 {
 	if v < min {
 		return min
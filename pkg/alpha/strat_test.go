@@ -0,0 +1,51 @@
+package alpha
+
+import (
+	"math"
+	"testing"
+)
+
+// TestMmStratFractionalInventory quotes half a lot short, which used to
+// be floored to a whole lot, and checks the skew is half a lot's worth.
+func TestMmStratFractionalInventory(t *testing.T) {
+	params := &Params{
+		MeSpan:         5,
+		EmaSpan:        5,
+		BaseSpread:     0.001,
+		InventoryLimit: 2,
+		LotSize:        1,
+		InventorySkewK: 0.5,
+		TradeSz:        0.001,
+	}
+
+	quote := func(inventory float64) Quote {
+		s := NewMmStrat(params)
+		var q Quote
+		for i := range 20 {
+			px := 100 + math.Sin(float64(i)/3)
+			c := Candle{Time: int64(i), Open: px, High: px + 0.5, Low: px - 0.5, Close: px, Volume: 10}
+			_, q = s.Process(c, inventory)
+		}
+		if !q.Valid {
+			t.Fatal("no quote after warm-up")
+		}
+		return q
+	}
+
+	flat, half, whole := quote(0), quote(-0.0005), quote(-0.001)
+	halfShift := half.BidPrice - flat.BidPrice
+	wholeShift := whole.BidPrice - flat.BidPrice
+	if halfShift <= 0 {
+		t.Fatalf("short inventory did not raise the bid: shift %g", halfShift)
+	}
+	if math.Abs(halfShift-wholeShift/2) > 1e-9 {
+		t.Errorf("half-lot skew %g, want half of the lot skew %g", halfShift, wholeShift)
+	}
+
+	if !half.BidActive || !half.AskActive || half.BidSize != 0.001 || half.AskSize != 0.001 {
+		t.Errorf("quote %+v, want a lot of 0.001 on both sides", half)
+	}
+	if edge := quote(-0.0015); edge.AskActive || !edge.BidActive {
+		t.Errorf("at 1.5 lots short ask active %v, bid active %v, want only the bid", edge.AskActive, edge.BidActive)
+	}
+}
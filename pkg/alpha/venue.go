@@ -0,0 +1,32 @@
+package alpha
+
+import (
+	"context"
+	"time"
+)
+
+type Venue interface {
+	FetchKlines(symbol, interval string, limit int, endTime string) ([]Candle, error)
+	WsKline(ctx context.Context, symbol, interval string, onTick func(Candle))
+	Sync(ctx context.Context, symbol string) error
+	Wait()
+	Inventory() float64
+	Fills() []Trade
+	Apply(quote Quote) error
+	Cancel() error
+	Flatten() error
+}
+
+// SleepCtx waits for d unless ctx ends first, reporting whether it slept.
+// Venues back off with it between retries and reconnects.
+func SleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
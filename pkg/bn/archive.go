@@ -0,0 +1,144 @@
+package bn
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mm/pkg/alpha"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportKlines reads kline archives as published on data.binance.vision. The
+// path may be a single .csv or .zip file or a directory holding several.
+func ImportKlines(path string) ([]alpha.Candle, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		files = files[:0]
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && (ext == ".csv" || ext == ".zip") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+
+	var candles []alpha.Candle
+	for _, file := range files {
+		var fileCandles []alpha.Candle
+		if strings.EqualFold(filepath.Ext(file), ".zip") {
+			fileCandles, err = importZip(file)
+		} else {
+			fileCandles, err = importCsvFile(file)
+		}
+		if err != nil {
+			return nil, err
+		}
+		candles = alpha.MergeCandles(candles, fileCandles)
+	}
+
+	return candles, nil
+}
+
+func importZip(path string) ([]alpha.Candle, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var candles []alpha.Candle
+	for _, f := range zr.File {
+		if !strings.EqualFold(filepath.Ext(f.Name), ".csv") {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		fileCandles, err := importCsv(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", path, f.Name, err)
+		}
+		candles = alpha.MergeCandles(candles, fileCandles)
+	}
+
+	return candles, nil
+}
+
+func importCsvFile(path string) ([]alpha.Candle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	candles, err := importCsv(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return candles, nil
+}
+
+func importCsv(r io.Reader) ([]alpha.Candle, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	candles := make([]alpha.Candle, 0, 44640)
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 6 {
+			return nil, fmt.Errorf("line %d: expected at least 6 columns, got %d", line, len(record))
+		}
+
+		openTime, err := strconv.ParseInt(strings.TrimSpace(record[0]), 10, 64)
+		if err != nil {
+			// Newer archives start with an "open_time,open,..." header
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		// Archives from 2025 on are stamped in microseconds
+		if openTime > 1e14 {
+			openTime /= 1000
+		}
+
+		c := alpha.Candle{Time: openTime}
+		fields := []*float64{&c.Open, &c.High, &c.Low, &c.Close, &c.Volume}
+		for i, field := range fields {
+			if *field, err = strconv.ParseFloat(strings.TrimSpace(record[i+1]), 64); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		candles = append(candles, c)
+	}
+
+	return candles, nil
+}
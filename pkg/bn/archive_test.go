@@ -0,0 +1,73 @@
+package bn
+
+import (
+	"path/filepath"
+	"testing"
+
+	"mm/pkg/alpha"
+)
+
+func TestImportKlines(t *testing.T) {
+	tests := []struct {
+		file  string
+		times []int64
+		first alpha.Candle
+	}{
+		{
+			file:  "noheader.csv",
+			times: []int64{1704067200000, 1704067260000, 1704067320000},
+			first: alpha.Candle{Time: 1704067200000, Open: 42283.58, High: 42298.62, Low: 42261.02, Close: 42298.61, Volume: 35.92724},
+		},
+		{
+			file:  "header.csv",
+			times: []int64{1704067380000, 1704067440000},
+			first: alpha.Candle{Time: 1704067380000, Open: 42284.99, High: 42291, Low: 42268.01, Close: 42273.47, Volume: 14.3852},
+		},
+		{
+			// 2025 archives stamp open times in microseconds
+			file:  "micro.csv",
+			times: []int64{1735689600000, 1735689660000},
+			first: alpha.Candle{Time: 1735689600000, Open: 93576, High: 93610.93, Low: 93537.5, Close: 93610.93, Volume: 8.21827},
+		},
+		{
+			file:  "zipped.zip",
+			times: []int64{1704153600000, 1704153660000},
+			first: alpha.Candle{Time: 1704153600000, Open: 44179.55, High: 44200, Low: 44160.12, Close: 44190.1, Volume: 30.11111},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			candles, err := ImportKlines(filepath.Join("testdata", "klines", tt.file))
+			if err != nil {
+				t.Fatalf("ImportKlines: %v", err)
+			}
+			if len(candles) != len(tt.times) {
+				t.Fatalf("got %d bars, want %d", len(candles), len(tt.times))
+			}
+			for i, c := range candles {
+				if c.Time != tt.times[i] {
+					t.Errorf("bar %d: OpenTime %d, want %d ms", i, c.Time, tt.times[i])
+				}
+			}
+			if candles[0] != tt.first {
+				t.Errorf("first bar %+v, want %+v", candles[0], tt.first)
+			}
+		})
+	}
+}
+
+func TestImportKlinesDir(t *testing.T) {
+	candles, err := ImportKlines(filepath.Join("testdata", "klines"))
+	if err != nil {
+		t.Fatalf("ImportKlines: %v", err)
+	}
+	if len(candles) != 9 {
+		t.Fatalf("got %d bars, want 9", len(candles))
+	}
+	for i := 1; i < len(candles); i++ {
+		if candles[i].Time <= candles[i-1].Time {
+			t.Errorf("bar %d at %d not after %d", i, candles[i].Time, candles[i-1].Time)
+		}
+	}
+}
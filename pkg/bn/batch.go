@@ -0,0 +1,211 @@
+package bn
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	maxBatchOrders  = 5
+	maxBatchCancels = 10
+)
+
+type orderReq struct {
+	clientID string
+	side     string
+	qty      float64
+	px       float64
+}
+
+// signedRequest sends params, HMAC signed, as the body of method path and
+// returns a copy of the response body.
+func (b *Binance) signedRequest(op, method, path, params string, c cost) ([]byte, error) {
+	builder := builderPool.Get().(*strings.Builder)
+	builder.Reset()
+	defer builderPool.Put(builder)
+
+	builder.WriteString(params)
+	builder.WriteString("&recvWindow=500")
+	builder.WriteString("&timestamp=")
+	builder.WriteString(strconv.FormatInt(b.now(), 10))
+
+	totalParams := builder.String()
+	signature := b.signHmac(totalParams)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI(b.profile.Rest + path)
+	req.Header.Set("X-MBX-APIKEY", b.apiKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.SetMethod(method)
+
+	req.AppendBodyString(totalParams)
+	req.AppendBodyString("&signature=")
+	req.AppendBodyString(signature)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := b.do(op, req, resp, c); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// batchResults tracks every accepted order of a batch response and returns
+// the rejected ones, by index into the request, with their errors.
+func (b *Binance) batchResults(op string, body []byte, clientIDs []string) (map[int]*Error, error) {
+	results := gjson.ParseBytes(body)
+	if !results.IsArray() {
+		return nil, &Error{Kind: ErrReject, Op: op, Msg: "unexpected batch response format"}
+	}
+
+	failed := make(map[int]*Error)
+	for i, r := range results.Array() {
+		if i >= len(clientIDs) {
+			break
+		}
+		if code := r.Get("code"); code.Exists() && r.Get("msg").Exists() && code.Int() != 200 {
+			failed[i] = &Error{Kind: ErrReject, Op: op + " " + clientIDs[i], Code: code.Int(), Msg: r.Get("msg").Str}
+			continue
+		}
+		b.orders.Track(r)
+	}
+
+	return failed, nil
+}
+
+// placeBatch sends LIMIT GTX orders through /fapi/v1/batchOrders, five per
+// request, and returns the per-order rejections keyed by request index.
+func (b *Binance) placeBatch(reqs []orderReq) (map[int]*Error, error) {
+	failed := make(map[int]*Error)
+	for start := 0; start < len(reqs); start += maxBatchOrders {
+		chunk := reqs[start:min(start+maxBatchOrders, len(reqs))]
+
+		orders := make([]map[string]string, len(chunk))
+		clientIDs := make([]string, len(chunk))
+		for i, r := range chunk {
+			clientIDs[i] = r.clientID
+			orders[i] = map[string]string{
+				"symbol":           b.symbol,
+				"type":             "LIMIT",
+				"timeInForce":      "GTX",
+				"newClientOrderId": r.clientID,
+				"side":             r.side,
+				"quantity":         strconv.FormatFloat(r.qty, 'f', b.szPrecision, 64),
+				"price":            strconv.FormatFloat(r.px, 'f', b.pxPrecision, 64),
+			}
+		}
+
+		c := costBatchOrders
+		c.orders = len(chunk)
+		body, err := b.sendBatch("PlaceBatch", fasthttp.MethodPost, orders, c)
+		if err != nil {
+			return nil, err
+		}
+		chunkFailed, err := b.batchResults("PlaceBatch", body, clientIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i, e := range chunkFailed {
+			failed[start+i] = e
+		}
+	}
+
+	return failed, nil
+}
+
+// modifyBatch amends resting orders in place, reqs carrying the original
+// client order ids.
+func (b *Binance) modifyBatch(reqs []orderReq) (map[int]*Error, error) {
+	failed := make(map[int]*Error)
+	for start := 0; start < len(reqs); start += maxBatchOrders {
+		chunk := reqs[start:min(start+maxBatchOrders, len(reqs))]
+
+		orders := make([]map[string]string, len(chunk))
+		clientIDs := make([]string, len(chunk))
+		for i, r := range chunk {
+			clientIDs[i] = r.clientID
+			orders[i] = map[string]string{
+				"symbol":            b.symbol,
+				"origClientOrderId": r.clientID,
+				"side":              r.side,
+				"quantity":          strconv.FormatFloat(r.qty, 'f', b.szPrecision, 64),
+				"price":             strconv.FormatFloat(r.px, 'f', b.pxPrecision, 64),
+			}
+		}
+
+		c := costBatchOrders
+		c.orders = len(chunk)
+		body, err := b.sendBatch("ModifyBatch", fasthttp.MethodPut, orders, c)
+		if err != nil {
+			return nil, err
+		}
+		chunkFailed, err := b.batchResults("ModifyBatch", body, clientIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i, e := range chunkFailed {
+			// No need to modify the order
+			if e.Code == -5027 {
+				continue
+			}
+			failed[start+i] = e
+		}
+	}
+
+	return failed, nil
+}
+
+// cancelBatch cancels orders by client id, ten per request. Orders the
+// exchange no longer knows are dropped from the book instead of failing.
+func (b *Binance) cancelBatch(clientIDs []string) error {
+	var errs []error
+	for start := 0; start < len(clientIDs); start += maxBatchCancels {
+		chunk := clientIDs[start:min(start+maxBatchCancels, len(clientIDs))]
+
+		list, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+
+		params := "symbol=" + b.symbol + "&origClientOrderIdList=" + url.QueryEscape(string(list))
+		body, err := b.signedRequest("CancelBatch", fasthttp.MethodDelete, "/fapi/v1/batchOrders", params, costCancel)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		failed, err := b.batchResults("CancelBatch", body, chunk)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for i, e := range failed {
+			if e.Code == -2011 {
+				b.orders.Drop(chunk[i])
+				continue
+			}
+			errs = append(errs, e)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *Binance) sendBatch(op, method string, orders []map[string]string, c cost) ([]byte, error) {
+	batch, err := json.Marshal(orders)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.signedRequest(op, method, "/fapi/v1/batchOrders", "batchOrders="+url.QueryEscape(string(batch)), c)
+}
@@ -0,0 +1,286 @@
+package bntest
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"mm/pkg/alpha"
+)
+
+type Order struct {
+	ID          int64
+	ClientID    string
+	Side        string // BUY or SELL
+	Type        string
+	TimeInForce string
+	Price       float64
+	Qty         float64
+	Filled      float64
+	AvgPrice    float64
+	Status      string
+	ReduceOnly  bool
+	UpdateTime  int64
+}
+
+type Fill struct {
+	TradeID  int64
+	ClientID string
+	Side     string
+	Price    float64
+	Qty      float64
+	Fee      float64
+	Maker    bool
+	Time     int64
+}
+
+// apiError is a Binance error body, {"code": ..., "msg": ...}.
+type apiError struct {
+	Code int64
+	Msg  string
+}
+
+func (e *apiError) Error() string {
+	return strconv.FormatInt(e.Code, 10) + " " + e.Msg
+}
+
+// maxKlines is the most bars one klines request may ask for.
+const maxKlines = 1500
+
+var (
+	errUnknownOrder = &apiError{-2011, "Unknown order sent."}
+	errNoOrder      = &apiError{-2013, "Order does not exist."}
+	errReduceOnly   = &apiError{-2022, "ReduceOnly Order is rejected."}
+	errPostOnly     = &apiError{-5022, "Due to the order could not be executed as maker, the Post Only order will be rejected."}
+	errNoModify     = &apiError{-5027, "No need to modify the order."}
+	errSymbol       = &apiError{-1121, "Invalid symbol."}
+	errOrderType    = &apiError{-1116, "Invalid orderType."}
+	errPrecision    = &apiError{-1111, "Precision is over the maximum defined for this asset."}
+	errTick         = &apiError{-4014, "Price not increased by tick size."}
+	errNotional     = &apiError{-4164, "Order's notional must be no smaller than the minimum."}
+	errDuplicate    = &apiError{-4015, "Client order id is not valid."}
+)
+
+func errParam(name string) *apiError {
+	return &apiError{-1102, "Mandatory parameter '" + name + "' was not sent, was empty/null, or malformed."}
+}
+
+// place accepts a LIMIT order onto the book or fills a MARKET order at the
+// last price. Post-only orders that would cross the last price are rejected.
+func (s *Server) place(p url.Values) (Order, error) {
+	if p.Get("symbol") != s.symbol {
+		return Order{}, errSymbol
+	}
+	side := p.Get("side")
+	if side != "BUY" && side != "SELL" {
+		return Order{}, errParam("side")
+	}
+	qty, err := strconv.ParseFloat(p.Get("quantity"), 64)
+	if err != nil || qty <= 0 {
+		return Order{}, errParam("quantity")
+	}
+	if !onGrid(qty, s.StepSize) {
+		return Order{}, errPrecision
+	}
+
+	s.nextID++
+	o := &Order{
+		ID:          s.nextID,
+		ClientID:    p.Get("newClientOrderId"),
+		Side:        side,
+		Type:        p.Get("type"),
+		TimeInForce: p.Get("timeInForce"),
+		Qty:         qty,
+		Status:      "NEW",
+		ReduceOnly:  p.Get("reduceOnly") == "true",
+		UpdateTime:  time.Now().UnixMilli(),
+	}
+	if o.ClientID == "" {
+		o.ClientID = "auto-" + strconv.FormatInt(o.ID, 10)
+	}
+	if _, ok := s.open[o.ClientID]; ok {
+		return Order{}, errDuplicate
+	}
+
+	switch o.Type {
+	case "MARKET":
+		if o.ReduceOnly {
+			o.Qty = math.Min(o.Qty, s.reducible(side))
+			if o.Qty <= 0 {
+				return Order{}, errReduceOnly
+			}
+		}
+		s.emitOrder(o, "NEW", Fill{})
+		s.fill(o, s.last, false)
+		return *o, nil
+	case "LIMIT":
+	default:
+		return Order{}, errOrderType
+	}
+
+	if p.Get("priceMatch") == "QUEUE" {
+		o.Price = s.queuePrice(side)
+	} else {
+		o.Price, err = strconv.ParseFloat(p.Get("price"), 64)
+		if err != nil || o.Price <= 0 {
+			return Order{}, errParam("price")
+		}
+		if !onGrid(o.Price, s.TickSize) {
+			return Order{}, errTick
+		}
+	}
+	if o.Price*o.Qty < s.MinNotional {
+		return Order{}, errNotional
+	}
+	if o.TimeInForce == "GTX" && s.crosses(side, o.Price) {
+		return Order{}, errPostOnly
+	}
+
+	s.open[o.ClientID] = o
+	s.book = append(s.book, o)
+	s.emitOrder(o, "NEW", Fill{})
+	return *o, nil
+}
+
+// modify amends the price and quantity of a resting order in place.
+func (s *Server) modify(p url.Values) (Order, error) {
+	o, ok := s.open[p.Get("origClientOrderId")]
+	if !ok {
+		return Order{}, errNoOrder
+	}
+	qty, err := strconv.ParseFloat(p.Get("quantity"), 64)
+	if err != nil || qty <= o.Filled {
+		return Order{}, errParam("quantity")
+	}
+	px, err := strconv.ParseFloat(p.Get("price"), 64)
+	if err != nil || px <= 0 {
+		return Order{}, errParam("price")
+	}
+	if !onGrid(qty, s.StepSize) {
+		return Order{}, errPrecision
+	}
+	if !onGrid(px, s.TickSize) {
+		return Order{}, errTick
+	}
+	if qty == o.Qty && px == o.Price {
+		return Order{}, errNoModify
+	}
+	if o.TimeInForce == "GTX" && s.crosses(o.Side, px) {
+		return Order{}, errPostOnly
+	}
+
+	o.Qty = qty
+	o.Price = px
+	o.UpdateTime = time.Now().UnixMilli()
+	s.emitOrder(o, "AMENDMENT", Fill{})
+	return *o, nil
+}
+
+func (s *Server) cancel(clientID string) (Order, error) {
+	o, ok := s.open[clientID]
+	if !ok {
+		return Order{}, errUnknownOrder
+	}
+
+	o.Status = "CANCELED"
+	o.UpdateTime = time.Now().UnixMilli()
+	s.remove(o)
+	s.emitOrder(o, "CANCELED", Fill{})
+	return *o, nil
+}
+
+func (s *Server) cancelAll() {
+	for _, o := range append([]*Order(nil), s.book...) {
+		s.cancel(o.ClientID)
+	}
+}
+
+// match fills every resting order the bar traded through, as maker at the
+// order price, oldest first.
+func (s *Server) match(c alpha.Candle) {
+	for _, o := range append([]*Order(nil), s.book...) {
+		if (o.Side == "BUY" && c.Low <= o.Price) || (o.Side == "SELL" && c.High >= o.Price) {
+			s.fill(o, o.Price, true)
+		}
+	}
+	s.last = c.Close
+}
+
+func (s *Server) fill(o *Order, px float64, maker bool) {
+	qty := o.Qty - o.Filled
+	fee := px * qty * s.TakerFee
+	if maker {
+		fee = px * qty * s.MakerFee
+	}
+
+	if o.Side == "BUY" {
+		s.position += qty
+	} else {
+		s.position -= qty
+	}
+	s.position = roundTo(s.position, s.StepSize)
+
+	o.AvgPrice = (o.AvgPrice*o.Filled + px*qty) / (o.Filled + qty)
+	o.Filled = o.Qty
+	o.Status = "FILLED"
+	o.UpdateTime = time.Now().UnixMilli()
+	s.remove(o)
+
+	s.nextTrade++
+	f := Fill{
+		TradeID:  s.nextTrade,
+		ClientID: o.ClientID,
+		Side:     o.Side,
+		Price:    px,
+		Qty:      qty,
+		Fee:      fee,
+		Maker:    maker,
+		Time:     o.UpdateTime,
+	}
+	s.fills = append(s.fills, f)
+	s.emitOrder(o, "TRADE", f)
+	s.emitAccount()
+}
+
+func (s *Server) remove(o *Order) {
+	delete(s.open, o.ClientID)
+	for i, r := range s.book {
+		if r == o {
+			s.book = append(s.book[:i], s.book[i+1:]...)
+			break
+		}
+	}
+}
+
+// crosses reports whether a limit order at px would take liquidity, the
+// last price standing in for the opposite best quote.
+func (s *Server) crosses(side string, px float64) bool {
+	if side == "BUY" {
+		return px >= s.last
+	}
+	return px <= s.last
+}
+
+func (s *Server) queuePrice(side string) float64 {
+	if side == "BUY" {
+		return roundTo(s.last-s.TickSize, s.TickSize)
+	}
+	return roundTo(s.last+s.TickSize, s.TickSize)
+}
+
+// reducible is how much of the position an order on side can close.
+func (s *Server) reducible(side string) float64 {
+	if side == "BUY" {
+		return math.Max(-s.position, 0)
+	}
+	return math.Max(s.position, 0)
+}
+
+func roundTo(v, step float64) float64 {
+	return math.Round(v/step) * step
+}
+
+func onGrid(v, step float64) bool {
+	return math.Abs(v-roundTo(v, step)) < step*1e-6
+}
@@ -0,0 +1,526 @@
+// Package bntest runs an in-process fake of the Binance USD-M futures API
+// for one symbol, so the live trading path can be exercised without network.
+//
+// The fake serves the REST endpoints the bn package uses, the kline and user
+// data streams and the WebSocket API. Its matching engine rests limit orders
+// and fills them in full, as maker at the order price, when a bar pushed
+// with Bar trades through them. Market orders fill at the last close.
+package bntest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mm/pkg/alpha"
+	"mm/pkg/bn"
+)
+
+type Server struct {
+	URLs bn.Endpoints
+
+	// Credentials and symbol rules. Change them before the first request.
+	APIKey      string
+	SecretKey   string
+	TickSize    float64
+	StepSize    float64
+	MinQty      float64
+	MinNotional float64
+	MakerFee    float64
+	TakerFee    float64
+	FeeAsset    string
+
+	http *httptest.Server
+	done chan struct{}
+
+	mu         sync.Mutex
+	symbol     string
+	interval   string
+	candles    []alpha.Candle
+	last       float64
+	nextID     int64
+	nextTrade  int64
+	open       map[string]*Order
+	book       []*Order
+	fills      []Fill
+	position   float64
+	listenKeys map[string]bool
+	klines     map[*stream]bool
+	users      map[*stream]bool
+	failures   map[string]int
+}
+
+// NewServer starts a fake exchange trading symbol, serving history as its
+// kline archive. The last candle's close is the initial price.
+func NewServer(symbol, interval string, history []alpha.Candle) *Server {
+	s := &Server{
+		APIKey:      "test-api-key",
+		SecretKey:   "test-secret-key",
+		TickSize:    0.1,
+		StepSize:    0.001,
+		MinQty:      0.001,
+		MinNotional: 5,
+		MakerFee:    0.0002,
+		TakerFee:    0.0005,
+		FeeAsset:    "USDT",
+		done:        make(chan struct{}),
+		symbol:      symbol,
+		interval:    interval,
+		candles:     append([]alpha.Candle(nil), history...),
+		open:        make(map[string]*Order),
+		listenKeys:  make(map[string]bool),
+		klines:      make(map[*stream]bool),
+		users:       make(map[*stream]bool),
+		failures:    make(map[string]int),
+	}
+	if len(history) > 0 {
+		s.last = history[len(history)-1].Close
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /fapi/v1/time", s.handleTime)
+	mux.HandleFunc("GET /fapi/v1/exchangeInfo", s.handleExchangeInfo)
+	mux.HandleFunc("GET /fapi/v1/klines", s.handleKlines)
+	mux.HandleFunc("POST /fapi/v1/order", s.signed(s.handlePlace))
+	mux.HandleFunc("PUT /fapi/v1/order", s.signed(s.handleModify))
+	mux.HandleFunc("DELETE /fapi/v1/order", s.signed(s.handleCancel))
+	mux.HandleFunc("POST /fapi/v1/batchOrders", s.signed(s.handleBatch(s.place)))
+	mux.HandleFunc("PUT /fapi/v1/batchOrders", s.signed(s.handleBatch(s.modify)))
+	mux.HandleFunc("DELETE /fapi/v1/batchOrders", s.signed(s.handleCancelBatch))
+	mux.HandleFunc("DELETE /fapi/v1/allOpenOrders", s.signed(s.handleCancelAll))
+	mux.HandleFunc("GET /fapi/v1/openOrders", s.signed(s.handleOpenOrders))
+	mux.HandleFunc("GET /fapi/v3/positionRisk", s.signed(s.handlePosition))
+	mux.HandleFunc("POST /fapi/v1/listenKey", s.handleListenKey)
+	mux.HandleFunc("PUT /fapi/v1/listenKey", s.handleListenKey)
+	mux.HandleFunc("GET /ws/{stream}", s.handleStream)
+	mux.HandleFunc("GET /ws-fapi/v1", s.handleWsAPI)
+
+	s.http = httptest.NewServer(s.failing(mux))
+	wsURL := "ws" + strings.TrimPrefix(s.http.URL, "http")
+	s.URLs = bn.Endpoints{
+		Rest:   s.http.URL,
+		Stream: wsURL,
+		WsAPI:  wsURL + "/ws-fapi/v1",
+	}
+
+	return s
+}
+
+// Close drops every stream and shuts the server down.
+func (s *Server) Close() {
+	close(s.done)
+	s.http.Close()
+}
+
+// Bar fills resting orders the candle traded through, then publishes it as
+// a closed kline.
+func (s *Server) Bar(c alpha.Candle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.match(c)
+	if n := len(s.candles); n > 0 && s.candles[n-1].Time == c.Time {
+		s.candles[n-1] = c
+	} else {
+		s.candles = append(s.candles, c)
+	}
+
+	msg, _ := json.Marshal(map[string]any{
+		"e": "kline",
+		"E": time.Now().UnixMilli(),
+		"s": s.symbol,
+		"k": map[string]any{
+			"t": c.Time,
+			"s": s.symbol,
+			"i": s.interval,
+			"o": formatFloat(c.Open),
+			"h": formatFloat(c.High),
+			"l": formatFloat(c.Low),
+			"c": formatFloat(c.Close),
+			"v": formatFloat(c.Volume),
+			"x": true,
+		},
+	})
+	broadcast(s.klines, msg)
+}
+
+func (s *Server) Position() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.position
+}
+
+// SetPosition replaces the position as if traded elsewhere and streams the
+// account update.
+func (s *Server) SetPosition(pz float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.position = pz
+	s.emitAccount()
+}
+
+// FailNext answers the next n requests to method path with an internal
+// error, as the exchange does when overloaded.
+func (s *Server) FailNext(method, path string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method+" "+path] += n
+}
+
+func (s *Server) failing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		s.mu.Lock()
+		fail := s.failures[key] > 0
+		if fail {
+			s.failures[key]--
+		}
+		s.mu.Unlock()
+
+		if fail {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"code": -1001, "msg": "Internal error; unable to process your request. Please try again."})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DropUserStreams disconnects every user data stream, as the exchange does
+// when a listen key expires.
+func (s *Server) DropUserStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for st := range s.users {
+		st.conn.Close()
+	}
+}
+
+// Open returns the resting orders, oldest first.
+func (s *Server) Open() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := make([]Order, len(s.book))
+	for i, o := range s.book {
+		orders[i] = *o
+	}
+	return orders
+}
+
+func (s *Server) Fills() []Fill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Fill(nil), s.fills...)
+}
+
+// Streams returns the number of connected kline and user data streams.
+func (s *Server) Streams() (klines, users int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.klines), len(s.users)
+}
+
+func (s *Server) handleTime(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"serverTime": time.Now().UnixMilli()})
+}
+
+func (s *Server) handleExchangeInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"timezone":   "UTC",
+		"serverTime": time.Now().UnixMilli(),
+		"symbols": []map[string]any{{
+			"symbol":      s.symbol,
+			"status":      "TRADING",
+			"marginAsset": "USDT",
+			"filters": []map[string]string{
+				{"filterType": "PRICE_FILTER", "tickSize": formatFloat(s.TickSize)},
+				{"filterType": "LOT_SIZE", "stepSize": formatFloat(s.StepSize), "minQty": formatFloat(s.MinQty), "maxQty": "1000"},
+				{"filterType": "MIN_NOTIONAL", "notional": formatFloat(s.MinNotional)},
+			},
+		}},
+	})
+}
+
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("symbol") != s.symbol {
+		writeError(w, errSymbol)
+		return
+	}
+	limit := 500
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxKlines {
+			writeError(w, errParam("limit"))
+			return
+		}
+	}
+	end := int64(1<<63 - 1)
+	if v := q.Get("endTime"); v != "" {
+		var err error
+		if end, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, errParam("endTime"))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	n := sort.Search(len(s.candles), func(i int) bool { return s.candles[i].Time > end })
+	page := s.candles[max(n-limit, 0):n]
+	rows := make([][]any, len(page))
+	for i, c := range page {
+		rows[i] = []any{c.Time, formatFloat(c.Open), formatFloat(c.High), formatFloat(c.Low), formatFloat(c.Close), formatFloat(c.Volume)}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, rows)
+}
+
+// signed checks the API key and HMAC signature of a request and passes its
+// parameters, from the body or the query string, on to h.
+func (s *Server) signed(h func(p url.Values) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-MBX-APIKEY") != s.APIKey {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"code": -2015, "msg": "Invalid API-key, IP, or permissions for action."})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, errParam("body"))
+			return
+		}
+		raw := string(body)
+		if raw == "" {
+			raw = r.URL.RawQuery
+		}
+
+		payload, signature, ok := strings.Cut(raw, "&signature=")
+		if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"code": -1022, "msg": "Signature for this request is not valid."})
+			return
+		}
+
+		p, err := url.ParseQuery(payload)
+		if err != nil {
+			writeError(w, errParam("params"))
+			return
+		}
+
+		s.mu.Lock()
+		resp, err := h(p)
+		s.mu.Unlock()
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func (s *Server) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.SecretKey))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) handlePlace(p url.Values) (any, error) {
+	o, err := s.place(p)
+	return s.orderJSON(o), err
+}
+
+func (s *Server) handleModify(p url.Values) (any, error) {
+	o, err := s.modify(p)
+	return s.orderJSON(o), err
+}
+
+func (s *Server) handleCancel(p url.Values) (any, error) {
+	o, err := s.cancel(p.Get("origClientOrderId"))
+	return s.orderJSON(o), err
+}
+
+// handleBatch runs op on each order of a batchOrders list and answers with
+// the order or the error of each, in request order.
+func (s *Server) handleBatch(op func(p url.Values) (Order, error)) func(p url.Values) (any, error) {
+	return func(p url.Values) (any, error) {
+		var orders []map[string]string
+		if err := json.Unmarshal([]byte(p.Get("batchOrders")), &orders); err != nil || len(orders) == 0 || len(orders) > 5 {
+			return nil, errParam("batchOrders")
+		}
+
+		results := make([]any, len(orders))
+		for i, params := range orders {
+			v := url.Values{}
+			for k, val := range params {
+				v.Set(k, val)
+			}
+			o, err := op(v)
+			results[i] = s.result(o, err)
+		}
+		return results, nil
+	}
+}
+
+func (s *Server) handleCancelBatch(p url.Values) (any, error) {
+	var clientIDs []string
+	if err := json.Unmarshal([]byte(p.Get("origClientOrderIdList")), &clientIDs); err != nil || len(clientIDs) == 0 || len(clientIDs) > 10 {
+		return nil, errParam("origClientOrderIdList")
+	}
+
+	results := make([]any, len(clientIDs))
+	for i, clientID := range clientIDs {
+		o, err := s.cancel(clientID)
+		results[i] = s.result(o, err)
+	}
+	return results, nil
+}
+
+func (s *Server) handleCancelAll(p url.Values) (any, error) {
+	if p.Get("symbol") != s.symbol {
+		return nil, errSymbol
+	}
+	s.cancelAll()
+	return map[string]any{"code": 200, "msg": "The operation of cancel all open order is done."}, nil
+}
+
+func (s *Server) handleOpenOrders(p url.Values) (any, error) {
+	if p.Get("symbol") != s.symbol {
+		return nil, errSymbol
+	}
+
+	orders := make([]any, len(s.book))
+	for i, o := range s.book {
+		orders[i] = s.orderJSON(*o)
+	}
+	return orders, nil
+}
+
+func (s *Server) handlePosition(p url.Values) (any, error) {
+	return []map[string]any{{
+		"symbol":      s.symbol,
+		"positionAmt": formatFloat(s.position),
+		"markPrice":   formatFloat(s.last),
+	}}, nil
+}
+
+func (s *Server) handleListenKey(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-MBX-APIKEY") != s.APIKey {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"code": -2015, "msg": "Invalid API-key, IP, or permissions for action."})
+		return
+	}
+
+	s.mu.Lock()
+	key := "listen-key-" + strconv.Itoa(len(s.listenKeys)+1)
+	s.listenKeys[key] = true
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{"listenKey": key})
+}
+
+func (s *Server) result(o Order, err error) any {
+	if err != nil {
+		e := err.(*apiError)
+		return map[string]any{"code": e.Code, "msg": e.Msg}
+	}
+	return s.orderJSON(o)
+}
+
+func (s *Server) orderJSON(o Order) map[string]any {
+	return map[string]any{
+		"orderId":       o.ID,
+		"symbol":        s.symbol,
+		"clientOrderId": o.ClientID,
+		"side":          o.Side,
+		"type":          o.Type,
+		"timeInForce":   o.TimeInForce,
+		"price":         formatFloat(o.Price),
+		"origQty":       formatFloat(o.Qty),
+		"executedQty":   formatFloat(o.Filled),
+		"avgPrice":      formatFloat(o.AvgPrice),
+		"status":        o.Status,
+		"reduceOnly":    o.ReduceOnly,
+		"updateTime":    o.UpdateTime,
+	}
+}
+
+// emitOrder publishes an ORDER_TRADE_UPDATE for o to the user streams.
+func (s *Server) emitOrder(o *Order, execType string, f Fill) {
+	msg, _ := json.Marshal(map[string]any{
+		"e": "ORDER_TRADE_UPDATE",
+		"E": o.UpdateTime,
+		"T": o.UpdateTime,
+		"o": map[string]any{
+			"s":  s.symbol,
+			"c":  o.ClientID,
+			"S":  o.Side,
+			"o":  o.Type,
+			"f":  o.TimeInForce,
+			"q":  formatFloat(o.Qty),
+			"p":  formatFloat(o.Price),
+			"ap": formatFloat(o.AvgPrice),
+			"x":  execType,
+			"X":  o.Status,
+			"i":  o.ID,
+			"l":  formatFloat(f.Qty),
+			"z":  formatFloat(o.Filled),
+			"L":  formatFloat(f.Price),
+			"n":  formatFloat(f.Fee),
+			"N":  s.FeeAsset,
+			"t":  f.TradeID,
+			"T":  o.UpdateTime,
+			"m":  f.Maker,
+			"R":  o.ReduceOnly,
+		},
+	})
+	broadcast(s.users, msg)
+}
+
+func (s *Server) emitAccount() {
+	now := time.Now().UnixMilli()
+	msg, _ := json.Marshal(map[string]any{
+		"e": "ACCOUNT_UPDATE",
+		"E": now,
+		"T": now,
+		"a": map[string]any{
+			"m": "ORDER",
+			"P": []map[string]any{{
+				"s":  s.symbol,
+				"pa": formatFloat(s.position),
+				"ps": "BOTH",
+			}},
+		},
+	})
+	broadcast(s.users, msg)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e := err.(*apiError)
+	writeJSON(w, http.StatusBadRequest, map[string]any{"code": e.Code, "msg": e.Msg})
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,211 @@
+package bntest
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/fasthttp/websocket"
+)
+
+var upgrader = websocket.Upgrader{}
+
+// stream is one websocket connection. Messages queue on out and are written
+// by a goroutine of their own, so publishing never blocks the engine.
+type stream struct {
+	conn   *websocket.Conn
+	out    chan []byte
+	closed chan struct{}
+}
+
+// broadcast queues msg on every stream in set, dropping it for streams too
+// far behind.
+func broadcast(set map[*stream]bool, msg []byte) {
+	for st := range set {
+		select {
+		case st.out <- msg:
+		default:
+		}
+	}
+}
+
+// serve upgrades r and runs the connection until either side closes it,
+// passing every received message to onMessage. The stream is registered in
+// set, if given, while it is connected.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, set map[*stream]bool, onMessage func(st *stream, msg []byte)) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	st := &stream{
+		conn:   conn,
+		out:    make(chan []byte, 1024),
+		closed: make(chan struct{}),
+	}
+	if set != nil {
+		s.mu.Lock()
+		set[st] = true
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			delete(set, st)
+			s.mu.Unlock()
+		}()
+	}
+
+	go func() {
+		for {
+			select {
+			case msg := <-st.out:
+				if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+					conn.Close()
+					return
+				}
+			case <-s.done:
+				conn.Close()
+				return
+			case <-st.closed:
+				return
+			}
+		}
+	}()
+	defer close(st.closed)
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if onMessage != nil {
+			onMessage(st, msg)
+		}
+	}
+}
+
+// handleStream serves /ws/<listenKey> as the user data stream and
+// /ws/<symbol>@kline_<interval> as the kline stream.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("stream")
+
+	s.mu.Lock()
+	isUser := s.listenKeys[name]
+	s.mu.Unlock()
+
+	switch {
+	case isUser:
+		s.serve(w, r, s.users, nil)
+	case name == strings.ToLower(s.symbol)+"@kline_"+s.interval:
+		s.serve(w, r, s.klines, nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleWsAPI serves the WebSocket API. session.logon accepts any
+// signature for the right API key; other requests must carry an HMAC
+// signature until the session is logged on.
+func (s *Server) handleWsAPI(w http.ResponseWriter, r *http.Request) {
+	logged := false
+
+	s.serve(w, r, nil, func(st *stream, msg []byte) {
+		var req struct {
+			ID     string            `json:"id"`
+			Method string            `json:"method"`
+			Params map[string]string `json:"params"`
+		}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return
+		}
+
+		result, err := s.wsCall(req.Method, req.Params, &logged)
+
+		resp := map[string]any{
+			"id":         req.ID,
+			"status":     200,
+			"result":     result,
+			"rateLimits": []any{},
+		}
+		if err != nil {
+			e := err.(*apiError)
+			resp = map[string]any{
+				"id":     req.ID,
+				"status": 400,
+				"error":  map[string]any{"code": e.Code, "msg": e.Msg},
+			}
+		}
+
+		data, _ := json.Marshal(resp)
+		select {
+		case st.out <- data:
+		case <-st.closed:
+		}
+	})
+}
+
+func (s *Server) wsCall(method string, params map[string]string, logged *bool) (any, error) {
+	if method == "session.logon" {
+		if params["apiKey"] != s.APIKey {
+			return nil, &apiError{-2015, "Invalid API-key, IP, or permissions for action."}
+		}
+		*logged = true
+		return map[string]any{"apiKey": s.APIKey}, nil
+	}
+
+	if !*logged {
+		if params["apiKey"] != s.APIKey {
+			return nil, &apiError{-2015, "Invalid API-key, IP, or permissions for action."}
+		}
+		signature := params["signature"]
+		delete(params, "signature")
+		if !hmac.Equal([]byte(signature), []byte(s.sign(encodeParams(params)))) {
+			return nil, &apiError{-1022, "Signature for this request is not valid."}
+		}
+	}
+
+	p := url.Values{}
+	for k, v := range params {
+		p.Set(k, v)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		o   Order
+		err error
+	)
+	switch method {
+	case "order.place":
+		o, err = s.place(p)
+	case "order.modify":
+		o, err = s.modify(p)
+	case "order.cancel":
+		o, err = s.cancel(p.Get("origClientOrderId"))
+	default:
+		return nil, &apiError{-1100, "Unknown method " + method + "."}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.orderJSON(o), nil
+}
+
+func encodeParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + params[k]
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,142 @@
+package bn
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	clockSamples  = 5
+	clockInterval = time.Minute
+	maxClockDrift = 100 // ms between two syncs worth a warning
+)
+
+var costTime = cost{weight: 1, essential: true}
+
+type ClockStats struct {
+	Offset    int64 // server minus local, ms
+	RTT       time.Duration
+	Drift     int64 // offset change since the previous sync, ms
+	MaxOffset int64 // largest |offset| seen, ms
+	Syncs     int64
+}
+
+// Clock estimates the offset of the local clock to the exchange so signed
+// requests carry a server-aligned timestamp.
+type Clock struct {
+	mu     sync.Mutex
+	stats  ClockStats
+	synced bool
+	resync atomic.Bool
+}
+
+func (c *Clock) Offset() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats.Offset
+}
+
+func (c *Clock) Stats() ClockStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *Clock) update(offset int64, rtt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.synced {
+		c.stats.Drift = offset - c.stats.Offset
+	}
+	c.synced = true
+	c.stats.Offset = offset
+	c.stats.RTT = rtt
+	c.stats.MaxOffset = max(c.stats.MaxOffset, int64(math.Abs(float64(offset))))
+	c.stats.Syncs++
+}
+
+// now is the current exchange time in milliseconds.
+func (b *Binance) now() int64 {
+	return time.Now().UnixMilli() + b.clock.Offset()
+}
+
+// syncClock samples /fapi/v1/time a few times and keeps the offset of the
+// fastest round trip, assuming the server stamped it half way through.
+func (b *Binance) syncClock() error {
+	bestRTT := time.Duration(math.MaxInt64)
+	bestOffset := int64(0)
+
+	for range clockSamples {
+		offset, rtt, err := b.sampleClock()
+		if err != nil {
+			return err
+		}
+		if rtt < bestRTT {
+			bestRTT = rtt
+			bestOffset = offset
+		}
+	}
+
+	b.clock.update(bestOffset, bestRTT)
+
+	stats := b.clock.Stats()
+	if abs64(stats.Drift) > maxClockDrift {
+		slog.Warn("Clock", "offset", stats.Offset, "drift", stats.Drift, "rtt", stats.RTT)
+	}
+
+	return nil
+}
+
+func (b *Binance) sampleClock() (int64, time.Duration, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/time")
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	sent := time.Now()
+	if err := b.do("ServerTime", req, resp, costTime); err != nil {
+		return 0, 0, err
+	}
+	received := time.Now()
+
+	serverTime := gjson.GetBytes(resp.Body(), "serverTime").Int()
+	rtt := received.Sub(sent)
+	local := sent.Add(rtt / 2).UnixMilli()
+
+	return serverTime - local, rtt, nil
+}
+
+// runClock resyncs every clockInterval until ctx is done.
+func (b *Binance) runClock(ctx context.Context) {
+	ticker := time.NewTicker(clockInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.syncClock(); err != nil {
+				slog.Error("Clock", "sync", err)
+			}
+		}
+	}
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
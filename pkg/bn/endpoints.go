@@ -0,0 +1,93 @@
+package bn
+
+import (
+	"fmt"
+	"mm/pkg/alpha"
+)
+
+// Endpoints are the base URLs of one Binance futures deployment.
+type Endpoints struct {
+	Rest   string // REST API, e.g. https://fapi.binance.com
+	Stream string // market and user data streams, without the /ws path
+	WsAPI  string // WebSocket API
+}
+
+// Profile is a deployment together with the environment variables holding
+// the credentials for it.
+type Profile struct {
+	Endpoints
+	APIKeyEnv     string
+	SecretKeyEnv  string
+	Ed25519KeyEnv string
+}
+
+var Mainnet = Endpoints{
+	Rest:   "https://fapi.binance.com",
+	Stream: "wss://fstream.binance.com",
+	WsAPI:  "wss://ws-fapi.binance.com/ws-fapi/v1",
+}
+
+var Testnet = Endpoints{
+	Rest:   "https://testnet.binancefuture.com",
+	Stream: "wss://fstream.binancefuture.com",
+	WsAPI:  "wss://testnet.binancefuture.com/ws-fapi/v1",
+}
+
+var Profiles = map[string]Profile{
+	"mainnet": {
+		Endpoints:     Mainnet,
+		APIKeyEnv:     "BINANCE_API_KEY",
+		SecretKeyEnv:  "BINANCE_SECRET_KEY",
+		Ed25519KeyEnv: "BINANCE_ED25519_KEY",
+	},
+	"testnet": {
+		Endpoints:     Testnet,
+		APIKeyEnv:     "BINANCE_TESTNET_API_KEY",
+		SecretKeyEnv:  "BINANCE_TESTNET_SECRET_KEY",
+		Ed25519KeyEnv: "BINANCE_TESTNET_ED25519_KEY",
+	},
+	// custom takes every URL from params
+	"custom": {
+		APIKeyEnv:     "BINANCE_API_KEY",
+		SecretKeyEnv:  "BINANCE_SECRET_KEY",
+		Ed25519KeyEnv: "BINANCE_ED25519_KEY",
+	},
+}
+
+// LookupProfile returns the profile named in params, mainnet by default,
+// with any URL or key variable set in params overriding it.
+func LookupProfile(params *alpha.Params) (Profile, error) {
+	name := params.Profile
+	if name == "" {
+		name = "mainnet"
+	}
+	p, ok := Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("bn: unknown profile %q", name)
+	}
+
+	if params.RestURL != "" {
+		p.Rest = params.RestURL
+	}
+	if params.StreamURL != "" {
+		p.Stream = params.StreamURL
+	}
+	if params.WsAPIURL != "" {
+		p.WsAPI = params.WsAPIURL
+	}
+	if params.APIKeyEnv != "" {
+		p.APIKeyEnv = params.APIKeyEnv
+	}
+	if params.SecretKeyEnv != "" {
+		p.SecretKeyEnv = params.SecretKeyEnv
+	}
+
+	if p.Rest == "" || p.Stream == "" {
+		return Profile{}, fmt.Errorf("bn: profile %q needs restUrl and streamUrl", name)
+	}
+	if p.WsAPI == "" && params.Transport == "ws" {
+		return Profile{}, fmt.Errorf("bn: profile %q needs wsApiUrl for the ws transport", name)
+	}
+
+	return p, nil
+}
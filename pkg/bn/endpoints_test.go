@@ -0,0 +1,27 @@
+package bn
+
+import (
+	"testing"
+
+	"mm/pkg/alpha"
+)
+
+func TestNewBinanceProfile(t *testing.T) {
+	for _, params := range []*alpha.Params{
+		{Profile: "staging"},
+		{Profile: "custom"},
+		{Profile: "custom", RestURL: "http://127.0.0.1:1", StreamURL: "ws://127.0.0.1:1", Transport: "ws"},
+	} {
+		if b, err := NewBinance(params); err == nil {
+			t.Errorf("NewBinance(%+v) = %+v, want an error", params, b.Profile())
+		}
+	}
+
+	b, err := NewBinance(&alpha.Params{Profile: "testnet"})
+	if err != nil {
+		t.Fatalf("NewBinance: %v", err)
+	}
+	if b.Profile().Rest != Profiles["testnet"].Rest {
+		t.Errorf("rest %q, want the testnet URL", b.Profile().Rest)
+	}
+}
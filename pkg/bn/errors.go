@@ -0,0 +1,172 @@
+package bn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mm/pkg/alpha"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/valyala/fasthttp"
+)
+
+type ErrorKind int
+
+const (
+	ErrNetwork ErrorKind = iota
+	ErrRateLimit
+	ErrAuth
+	ErrReject
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrNetwork:
+		return "network"
+	case ErrRateLimit:
+		return "rate-limit"
+	case ErrAuth:
+		return "auth"
+	case ErrReject:
+		return "reject"
+	}
+	return "unknown"
+}
+
+type Error struct {
+	Kind       ErrorKind
+	Op         string
+	Status     int
+	Code       int64
+	Msg        string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("bn: %s: %s: %v", e.Op, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("bn: %s: %s: code %d: %s", e.Op, e.Kind, e.Code, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether repeating the same request may succeed.
+func (e *Error) Temporary() bool {
+	switch e.Kind {
+	case ErrNetwork, ErrRateLimit:
+		return true
+	case ErrReject:
+		// -1021 timestamp outside recvWindow, -1007 backend timeout
+		return e.Code == -1021 || e.Code == -1007
+	}
+	return false
+}
+
+// Fatal reports whether the session cannot continue, e.g. bad API keys.
+func (e *Error) Fatal() bool {
+	return e.Kind == ErrAuth
+}
+
+func networkError(op string, err error) *Error {
+	return &Error{Kind: ErrNetwork, Op: op, Err: err}
+}
+
+// checkResponse turns a non-2xx status or a {"code","msg"} body into an *Error.
+func checkResponse(op string, resp *fasthttp.Response) error {
+	status := resp.StatusCode()
+	body := resp.Body()
+	msg := gjson.GetBytes(body, "msg")
+	// allOpenOrders reports success as {"code": 200, "msg": "..."}
+	if status < 300 && (!msg.Exists() || gjson.GetBytes(body, "code").Int() == 200) {
+		return nil
+	}
+
+	e := &Error{
+		Op:     op,
+		Status: status,
+		Code:   gjson.GetBytes(body, "code").Int(),
+		Msg:    msg.Str,
+	}
+	if !msg.Exists() {
+		e.Msg = string(body)
+	}
+	if secs, err := strconv.Atoi(string(resp.Header.Peek("Retry-After"))); err == nil {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+
+	return classify(e)
+}
+
+// classify sets the kind of an exchange error from its HTTP status and code.
+func classify(e *Error) *Error {
+	switch {
+	case e.Status == fasthttp.StatusTooManyRequests || e.Status == fasthttp.StatusTeapot || e.Code == -1003:
+		e.Kind = ErrRateLimit
+	case e.Status == fasthttp.StatusUnauthorized || e.Status == fasthttp.StatusForbidden ||
+		e.Code == -2014 || e.Code == -2015 || e.Code == -1022:
+		e.Kind = ErrAuth
+	case e.Status >= 500:
+		e.Kind = ErrNetwork
+	default:
+		e.Kind = ErrReject
+	}
+
+	return e
+}
+
+type Retry struct {
+	Attempts int
+	Base     time.Duration
+	Max      time.Duration
+}
+
+var DefaultRetry = Retry{
+	Attempts: 3,
+	Base:     200 * time.Millisecond,
+	Max:      5 * time.Second,
+}
+
+// Delay is the exponential backoff before the given (zero based) retry.
+func (r Retry) Delay(attempt int) time.Duration {
+	d := r.Base << min(attempt, 16)
+	if d <= 0 || d > r.Max {
+		d = r.Max
+	}
+	return d
+}
+
+// Do runs op until it succeeds, fails permanently or attempts run out,
+// honouring Retry-After on rate limits. A done ctx ends the backoff early
+// with the last error.
+func (r Retry) Do(ctx context.Context, op func() error) error {
+	var err error
+	for attempt := 0; attempt < max(r.Attempts, 1); attempt++ {
+		if attempt > 0 {
+			delay := r.Delay(attempt - 1)
+			var e *Error
+			if errors.As(err, &e) && e.RetryAfter > delay {
+				delay = e.RetryAfter
+			}
+			if !alpha.SleepCtx(ctx, delay) {
+				return err
+			}
+		}
+
+		if err = op(); err == nil {
+			return nil
+		}
+
+		var e *Error
+		if !errors.As(err, &e) || !e.Temporary() {
+			return err
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,31 @@
+package bn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryDoStopsOnContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	limited := &Error{Kind: ErrRateLimit, Op: "Cancel", RetryAfter: time.Minute}
+	calls := 0
+	start := time.Now()
+	err := DefaultRetry.Do(ctx, func() error {
+		calls++
+		return limited
+	})
+
+	if !errors.Is(err, limited) {
+		t.Errorf("Do = %v, want the rate-limit error", err)
+	}
+	if calls != 1 {
+		t.Errorf("op ran %d times after cancel, want 1", calls)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Do waited %s on a done context", d)
+	}
+}
@@ -0,0 +1,127 @@
+package bn
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/valyala/fasthttp"
+)
+
+var costExchangeInfo = cost{weight: 1, essential: true}
+
+type SymbolFilters struct {
+	TickSize    float64
+	StepSize    float64
+	MinQty      float64
+	MaxQty      float64
+	MinNotional float64
+	PxPrecision int
+	SzPrecision int
+	MarginAsset string
+}
+
+func (b *Binance) fetchFilters(symbol string) (SymbolFilters, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/exchangeInfo")
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	if err := b.do("ExchangeInfo", req, resp, costExchangeInfo); err != nil {
+		return SymbolFilters{}, err
+	}
+
+	for _, s := range gjson.GetBytes(resp.Body(), "symbols").Array() {
+		if s.Get("symbol").Str != symbol {
+			continue
+		}
+
+		f := SymbolFilters{MarginAsset: s.Get("marginAsset").Str}
+		for _, filter := range s.Get("filters").Array() {
+			switch filter.Get("filterType").Str {
+			case "PRICE_FILTER":
+				f.TickSize = filter.Get("tickSize").Float()
+				f.PxPrecision = decimals(filter.Get("tickSize").Str)
+			case "LOT_SIZE":
+				f.StepSize = filter.Get("stepSize").Float()
+				f.SzPrecision = decimals(filter.Get("stepSize").Str)
+				f.MinQty = filter.Get("minQty").Float()
+				f.MaxQty = filter.Get("maxQty").Float()
+			case "MIN_NOTIONAL":
+				f.MinNotional = filter.Get("notional").Float()
+			}
+		}
+		if f.TickSize <= 0 || f.StepSize <= 0 {
+			return SymbolFilters{}, &Error{Kind: ErrReject, Op: "ExchangeInfo", Msg: symbol + " has no PRICE_FILTER/LOT_SIZE"}
+		}
+		return f, nil
+	}
+
+	return SymbolFilters{}, &Error{Kind: ErrReject, Op: "ExchangeInfo", Msg: "unknown symbol " + symbol}
+}
+
+// applyFilters checks the configured sizes and precisions against the
+// exchange rules and switches rounding over to them.
+func (b *Binance) applyFilters(f SymbolFilters) error {
+	var conflicts []string
+
+	lot := b.tradeSz * float64(b.lotSize)
+	if !onGrid(b.tradeSz, f.StepSize) {
+		conflicts = append(conflicts, fmt.Sprintf("tradeSz %g is not a multiple of stepSize %g", b.tradeSz, f.StepSize))
+	}
+	if lot < f.MinQty {
+		conflicts = append(conflicts, fmt.Sprintf("lot of %g is below minQty %g", lot, f.MinQty))
+	}
+	if f.MaxQty > 0 && lot > f.MaxQty {
+		conflicts = append(conflicts, fmt.Sprintf("lot of %g is above maxQty %g", lot, f.MaxQty))
+	}
+	if b.pxPrecision > f.PxPrecision {
+		conflicts = append(conflicts, fmt.Sprintf("pxPrecision %d is finer than tickSize %g", b.pxPrecision, f.TickSize))
+	}
+	if b.szPrecision > f.SzPrecision {
+		conflicts = append(conflicts, fmt.Sprintf("szPrecision %d is finer than stepSize %g", b.szPrecision, f.StepSize))
+	}
+	if len(conflicts) > 0 {
+		return &Error{Kind: ErrReject, Op: "ExchangeInfo", Msg: b.symbol + ": " + strings.Join(conflicts, "; ")}
+	}
+
+	b.filters = f
+	b.orders.SetQuoteAsset(f.MarginAsset)
+	b.pxPrecision = f.PxPrecision
+	b.szPrecision = f.SzPrecision
+	return nil
+}
+
+func (b *Binance) Filters() SymbolFilters {
+	return b.filters
+}
+
+// decimals counts the significant fraction digits of a filter value such
+// as "0.00100000".
+func decimals(s string) int {
+	_, frac, ok := strings.Cut(s, ".")
+	if !ok {
+		return 0
+	}
+	return len(strings.TrimRight(frac, "0"))
+}
+
+func floorTo(v, step float64) float64 {
+	return math.Floor(v/step+1e-9) * step
+}
+
+func ceilTo(v, step float64) float64 {
+	return math.Ceil(v/step-1e-9) * step
+}
+
+func roundTo(v, step float64) float64 {
+	return math.Round(v/step) * step
+}
+
+func onGrid(v, step float64) bool {
+	return math.Abs(v-roundTo(v, step)) < step*1e-6
+}
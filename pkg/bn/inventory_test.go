@@ -0,0 +1,75 @@
+package bn_test
+
+import (
+	"context"
+	"testing"
+
+	"mm/pkg/alpha"
+	"mm/pkg/bn"
+	"mm/pkg/bn/bntest"
+)
+
+// TestFractionalInventory holds half a lot short, which used to be floored
+// to a whole lot, and checks sizes are only rounded to the step on submit.
+func TestFractionalInventory(t *testing.T) {
+	srv := bntest.NewServer("BTCUSDT", "1m", []alpha.Candle{{Time: 1_700_000_000_000, Close: 60000}})
+	defer srv.Close()
+	srv.StepSize = 0.0001
+	srv.MinQty = 0.0001
+	srv.SetPosition(-0.0005)
+
+	t.Setenv("BINANCE_API_KEY", srv.APIKey)
+	t.Setenv("BINANCE_SECRET_KEY", srv.SecretKey)
+
+	b, err := bn.NewBinance(&alpha.Params{
+		Symbol:      "BTCUSDT",
+		LotSize:     1,
+		TradeSz:     0.001,
+		PxPrecision: 1,
+		SzPrecision: 4,
+		Profile:     "custom",
+		RestURL:     srv.URLs.Rest,
+		StreamURL:   srv.URLs.Stream,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		b.Wait()
+	}()
+	if err := b.Sync(ctx, "BTCUSDT"); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if inv := b.Inventory(); inv != -0.0005 {
+		t.Errorf("Inventory = %g, want -0.0005", inv)
+	}
+
+	err = b.Apply(alpha.Quote{BidPrice: 59000, BidSize: 0.00123, BidActive: true, AskPrice: 61000, Valid: true})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	open := srv.Open()
+	if len(open) != 1 || open[0].Qty != 0.0012 {
+		t.Fatalf("resting %+v, want one bid of 0.0012", open)
+	}
+	if inv := b.Inventory(); inv != -0.0005 {
+		t.Errorf("Inventory = %g after quoting, want -0.0005", inv)
+	}
+
+	if err := b.Cancel(); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if err := b.Flatten(); err != nil {
+		t.Fatalf("Flatten: %v", err)
+	}
+	if pz := srv.Position(); pz != 0 {
+		t.Errorf("position %g after flatten, want 0", pz)
+	}
+	if inv := b.Inventory(); inv != 0 {
+		t.Errorf("Inventory = %g after flatten, want 0", inv)
+	}
+}
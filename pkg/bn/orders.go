@@ -0,0 +1,293 @@
+package bn
+
+import (
+	"mm/pkg/alpha"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	maxClosedOrders = 1000
+	maxSeenTrades   = 10 * maxClosedOrders
+)
+
+var clientIDSeq atomic.Uint64
+
+// newClientID returns a unique id for orders placed by this process.
+func newClientID() string {
+	return "mm-" + strconv.FormatInt(time.Now().UnixMilli(), 36) + "-" + strconv.FormatUint(clientIDSeq.Add(1), 36)
+}
+
+type LiveOrder struct {
+	ClientID  string
+	OrderID   int64
+	Side      string
+	Price     float64
+	Qty       float64
+	Status    string
+	FilledQty float64
+	AvgPrice  float64
+	Fee       float64
+	FeeAsset  string
+	UpdatedAt int64
+}
+
+func (o *LiveOrder) Done() bool {
+	switch o.Status {
+	case "FILLED", "CANCELED", "EXPIRED", "EXPIRED_IN_MATCH", "REJECTED":
+		return true
+	}
+	return false
+}
+
+// OrderBook keeps our own orders for one symbol up to date from the user
+// data stream and queues their executions as alpha.Trade values, once per
+// trade id however often the stream delivers it.
+type OrderBook struct {
+	mu         sync.Mutex
+	quoteAsset string
+	open       map[string]*LiveOrder
+	closed     []LiveOrder
+	fills      []alpha.Trade
+	seen       map[int64]bool
+	seenOrder  []int64
+}
+
+func NewOrderBook() *OrderBook {
+	return &OrderBook{
+		open: make(map[string]*LiveOrder),
+		seen: make(map[int64]bool),
+	}
+}
+
+// SetQuoteAsset names the asset fees are booked in as is; fees charged in
+// any other asset, e.g. BNB, keep it in Trade.FeeAsset.
+func (ob *OrderBook) SetQuoteAsset(asset string) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.quoteAsset = asset
+}
+
+// order returns the tracked order for clientID, creating an open one if it
+// has never been seen.
+func (ob *OrderBook) order(clientID string) *LiveOrder {
+	if order, ok := ob.open[clientID]; ok {
+		return order
+	}
+	for i := len(ob.closed) - 1; i >= 0; i-- {
+		if ob.closed[i].ClientID == clientID {
+			return &ob.closed[i]
+		}
+	}
+
+	order := &LiveOrder{ClientID: clientID}
+	ob.open[clientID] = order
+	return order
+}
+
+// Track records an order from a REST order response, so it is known before
+// its first user data stream event arrives.
+func (ob *OrderBook) Track(o gjson.Result) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.track(o)
+}
+
+// Replace sets the open orders to an openOrders response. Orders missing
+// from it finished while the user data stream was not listening.
+func (ob *OrderBook) Replace(orders []gjson.Result) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	resting := make(map[string]bool, len(orders))
+	for _, o := range orders {
+		resting[o.Get("clientOrderId").Str] = true
+		ob.track(o)
+	}
+	for clientID, order := range ob.open {
+		if !resting[clientID] {
+			order.Status = "CANCELED"
+			ob.settle(order)
+		}
+	}
+}
+
+func (ob *OrderBook) track(o gjson.Result) {
+	clientID := o.Get("clientOrderId").Str
+	if clientID == "" {
+		return
+	}
+
+	// A stream event may already have moved the order further along
+	order := ob.order(clientID)
+	updatedAt := o.Get("updateTime").Int()
+	if updatedAt < order.UpdatedAt {
+		return
+	}
+	order.UpdatedAt = updatedAt
+
+	order.OrderID = o.Get("orderId").Int()
+	order.Side = side(o.Get("side").Str)
+	order.Price = o.Get("price").Float()
+	order.Qty = o.Get("origQty").Float()
+	order.Status = o.Get("status").Str
+	order.FilledQty = o.Get("executedQty").Float()
+	order.AvgPrice = o.Get("avgPrice").Float()
+	ob.settle(order)
+}
+
+// CancelAll marks every open order cancelled after a successful mass cancel.
+func (ob *OrderBook) CancelAll() {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for _, order := range ob.open {
+		order.Status = "CANCELED"
+		ob.settle(order)
+	}
+}
+
+// Drop forgets an open order the exchange no longer knows about.
+func (ob *OrderBook) Drop(clientID string) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if order, ok := ob.open[clientID]; ok {
+		order.Status = "CANCELED"
+		ob.settle(order)
+	}
+}
+
+// settle moves a finished order from the open set to the closed history.
+func (ob *OrderBook) settle(order *LiveOrder) {
+	if !order.Done() {
+		return
+	}
+	if _, ok := ob.open[order.ClientID]; !ok {
+		return
+	}
+
+	delete(ob.open, order.ClientID)
+	ob.closed = append(ob.closed, *order)
+	if len(ob.closed) > maxClosedOrders {
+		ob.closed = ob.closed[len(ob.closed)-maxClosedOrders:]
+	}
+}
+
+// Update applies the "o" object of an ORDER_TRADE_UPDATE event. A trade
+// delivered again is ignored.
+func (ob *OrderBook) Update(o gjson.Result) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	isTrade := o.Get("x").Str == "TRADE"
+	if isTrade && !ob.markSeen(o.Get("t").Int()) {
+		return
+	}
+
+	clientID := o.Get("c").Str
+	order := ob.order(clientID)
+
+	order.OrderID = o.Get("i").Int()
+	order.Side = side(o.Get("S").Str)
+	order.Price = o.Get("p").Float()
+	order.Qty = o.Get("q").Float()
+	order.Status = o.Get("X").Str
+	order.FilledQty = o.Get("z").Float()
+	order.AvgPrice = o.Get("ap").Float()
+	order.UpdatedAt = o.Get("T").Int()
+
+	if isTrade {
+		fee := o.Get("n").Float()
+		order.Fee += fee
+		order.FeeAsset = o.Get("N").Str
+
+		trade := alpha.Trade{
+			Side:  order.Side,
+			Time:  order.UpdatedAt,
+			Price: o.Get("L").Float(),
+			Size:  o.Get("l").Float(),
+			Fee:   fee,
+			Taker: !o.Get("m").Bool(),
+		}
+		if order.FeeAsset != "" && order.FeeAsset != ob.quoteAsset {
+			trade.FeeAsset = order.FeeAsset
+		}
+		ob.fills = append(ob.fills, trade)
+	}
+
+	ob.settle(order)
+}
+
+// markSeen records a trade id, reporting false if it was already booked.
+func (ob *OrderBook) markSeen(tradeID int64) bool {
+	if ob.seen[tradeID] {
+		return false
+	}
+
+	ob.seen[tradeID] = true
+	ob.seenOrder = append(ob.seenOrder, tradeID)
+	if len(ob.seenOrder) > maxSeenTrades {
+		delete(ob.seen, ob.seenOrder[0])
+		ob.seenOrder = ob.seenOrder[1:]
+	}
+	return true
+}
+
+// Open returns a snapshot of the orders still working on the book.
+func (ob *OrderBook) Open() []LiveOrder {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	orders := make([]LiveOrder, 0, len(ob.open))
+	for _, order := range ob.open {
+		orders = append(orders, *order)
+	}
+	return orders
+}
+
+// Closed returns the most recent finished orders, oldest first.
+func (ob *OrderBook) Closed() []LiveOrder {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return append([]LiveOrder(nil), ob.closed...)
+}
+
+func (ob *OrderBook) Get(clientID string) (LiveOrder, bool) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if order, ok := ob.open[clientID]; ok {
+		return *order, true
+	}
+	for i := len(ob.closed) - 1; i >= 0; i-- {
+		if ob.closed[i].ClientID == clientID {
+			return ob.closed[i], true
+		}
+	}
+	return LiveOrder{}, false
+}
+
+// Fills drains the executions received since the previous call.
+func (ob *OrderBook) Fills() []alpha.Trade {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	fills := ob.fills
+	ob.fills = nil
+	return fills
+}
+
+func side(s string) string {
+	if s == "SELL" {
+		return "sell"
+	}
+	return "buy"
+}
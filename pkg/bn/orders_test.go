@@ -0,0 +1,31 @@
+package bn
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestOrderBookUpdateTrades(t *testing.T) {
+	ob := NewOrderBook()
+	ob.SetQuoteAsset("USDT")
+
+	usdt := gjson.Parse(`{"c":"mm-1","i":1,"S":"BUY","p":"100","q":"2","X":"PARTIALLY_FILLED","x":"TRADE","t":7,"l":"1","L":"100","n":"0.02","N":"USDT","m":true,"T":1}`)
+	bnb := gjson.Parse(`{"c":"mm-1","i":1,"S":"BUY","p":"100","q":"2","X":"FILLED","x":"TRADE","t":8,"l":"1","L":"100","n":"0.0001","N":"BNB","m":true,"T":2}`)
+
+	// The stream redelivers the first trade after a reconnect
+	ob.Update(usdt)
+	ob.Update(usdt)
+	ob.Update(bnb)
+
+	fills := ob.Fills()
+	if len(fills) != 2 {
+		t.Fatalf("got %d fills, want 2", len(fills))
+	}
+	if fills[0].FeeAsset != "" || fills[0].Fee != 0.02 {
+		t.Errorf("quote fee booked as %g %q", fills[0].Fee, fills[0].FeeAsset)
+	}
+	if fills[1].FeeAsset != "BNB" || fills[1].Fee != 0.0001 {
+		t.Errorf("BNB fee booked as %g %q", fills[1].Fee, fills[1].FeeAsset)
+	}
+}
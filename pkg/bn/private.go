@@ -1,16 +1,20 @@
 package bn
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
 	"mm/pkg/alpha"
+	"mm/pkg/journal"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fasthttp/websocket"
@@ -26,46 +30,136 @@ var builderPool = sync.Pool{
 
 type Binance struct {
 	client    *fasthttp.Client
+	profile   Profile
+	limiter   *Limiter
+	clock     Clock
+	retry     Retry
+	wg        sync.WaitGroup
 	apiKey    string
 	secretKey string
 
 	symbol      string
 	szPrecision int
 	pxPrecision int
+	filters     SymbolFilters
 
-	pxFactor float64
-	szFactor float64
-	tradeSz  float64
-	pz       float64
+	tradeSz      float64
+	lotSize      int
+	requoteTicks int
+	pz           atomic.Uint64 // float64 bits, written by the user data stream
+	orders       *OrderBook
+	sent         atomic.Int64 // orders placed, amended or cancelled
+
+	transport string
+	ws        *wsAPI
+	recorder  journal.Recorder
+
+	ctx context.Context // session from Sync, bounds retry backoff
 }
 
-func NewBinance(params *alpha.Params) *Binance {
+// NewBinance connects to the profile named in params, see LookupProfile.
+func NewBinance(params *alpha.Params) (*Binance, error) {
+	profile, err := LookupProfile(params)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Binance{
 		client:      &fasthttp.Client{},
+		profile:     profile,
+		limiter:     DefaultLimiter,
+		retry:       DefaultRetry,
 		pxPrecision: params.PxPrecision,
 		szPrecision: params.SzPrecision,
-		pxFactor:    math.Pow10(params.PxPrecision),
-		szFactor:    math.Pow10(params.SzPrecision),
-		tradeSz:     params.TradeSz,
-	}
+		filters: SymbolFilters{
+			TickSize:    math.Pow10(-params.PxPrecision),
+			StepSize:    math.Pow10(-params.SzPrecision),
+			PxPrecision: params.PxPrecision,
+			SzPrecision: params.SzPrecision,
+		},
+		tradeSz:      params.TradeSz,
+		lotSize:      params.LotSize,
+		requoteTicks: params.RequoteTicks,
+		orders:       NewOrderBook(),
+		transport:    params.Transport,
+		ctx:          context.Background(),
+	}, nil
 }
 
-func (b *Binance) Sync(symbol string) {
+// Sync loads the position and follows the user data stream until ctx is done.
+func (b *Binance) Sync(ctx context.Context, symbol string) error {
+	b.ctx = ctx
 	b.symbol = symbol
 
-	b.apiKey = strings.TrimSpace(os.Getenv("BINANCE_API_KEY"))
+	b.apiKey = strings.TrimSpace(os.Getenv(b.profile.APIKeyEnv))
 	if b.apiKey == "" {
-		panic("BINANCE_API_KEY not set")
+		return &Error{Kind: ErrAuth, Op: "Sync", Msg: b.profile.APIKeyEnv + " not set"}
 	}
 
-	b.secretKey = strings.TrimSpace(os.Getenv("BINANCE_SECRET_KEY"))
+	b.secretKey = strings.TrimSpace(os.Getenv(b.profile.SecretKeyEnv))
 	if b.secretKey == "" {
-		panic("BINANCE_SECRET_KEY not set")
+		return &Error{Kind: ErrAuth, Op: "Sync", Msg: b.profile.SecretKeyEnv + " not set"}
+	}
+
+	var filters SymbolFilters
+	err := b.retry.Do(ctx, func() error {
+		var err error
+		filters, err = b.fetchFilters(symbol)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := b.applyFilters(filters); err != nil {
+		return err
 	}
+	slog.Info("Filters", "tick", filters.TickSize, "step", filters.StepSize, "minQty", filters.MinQty, "minNotional", filters.MinNotional)
+
+	if err := b.retry.Do(ctx, b.syncClock); err != nil {
+		return err
+	}
+	stats := b.clock.Stats()
+	slog.Info("Clock", "offset", stats.Offset, "rtt", stats.RTT)
+
+	if err := b.resync(ctx); err != nil {
+		return err
+	}
+
+	switch b.transport {
+	case "", "rest":
+	case "ws":
+		ws, err := newWsAPI(b, b.profile.WsAPI)
+		if err != nil {
+			return err
+		}
+		b.ws = ws
+		b.wg.Go(func() { ws.run(ctx) })
+	default:
+		return fmt.Errorf("bn: unknown transport %q", b.transport)
+	}
+
+	b.wg.Go(func() { b.runClock(ctx) })
+	b.wg.Go(func() { b.wsUser(ctx) })
+
+	return nil
+}
+
+// SetRecorder journals every websocket frame received from then on.
+func (b *Binance) SetRecorder(r journal.Recorder) {
+	b.recorder = r
+}
+
+// Wait blocks until the user data stream goroutines have exited.
+func (b *Binance) Wait() {
+	b.wg.Wait()
+}
 
-	b.pz = b.getPz()
+func (b *Binance) Profile() Profile {
+	return b.profile
+}
 
-	go b.wsUser()
+func (b *Binance) Clock() ClockStats {
+	return b.clock.Stats()
 }
 
 func (b *Binance) signHmac(data string) string {
@@ -78,22 +172,133 @@ func (b *Binance) signHmac(data string) string {
 	return fmt.Sprintf("%x", (mac.Sum(nil)))
 }
 
-func (b *Binance) Inventory() int {
-	return int(math.Floor(b.pz / b.tradeSz))
+func (b *Binance) Orders() *OrderBook {
+	return b.orders
+}
+
+func (b *Binance) Fills() []alpha.Trade {
+	return b.orders.Fills()
+}
+
+// OrdersSent counts the orders placed, amended or cancelled one by one,
+// batched or not, since the venue was created.
+func (b *Binance) OrdersSent() int64 {
+	return b.sent.Load()
 }
 
-func (b *Binance) Apply(quote alpha.Quote) {
-	b.cancelOrders()
+func (b *Binance) Inventory() float64 {
+	return b.position()
+}
+
+// cleanupTimeout bounds Cancel and Flatten, which usually run after the
+// session ctx is done and must still get their retries.
+const cleanupTimeout = 10 * time.Second
+
+func (b *Binance) cleanupCtx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(b.ctx), cleanupTimeout)
+}
+
+func (b *Binance) Cancel() error {
+	ctx, cancel := b.cleanupCtx()
+	defer cancel()
 
-	if quote.BidActive && quote.BidSize > 0 && !math.IsNaN(quote.BidPrice) {
-		go b.placeOrder(float64(quote.BidSize)*b.tradeSz, math.Floor(quote.BidPrice*b.pxFactor)/b.pxFactor)
+	if err := b.retry.Do(ctx, b.cancelOrders); err != nil {
+		return err
 	}
-	if quote.AskActive && quote.AskSize > 0 && !math.IsNaN(quote.AskPrice) {
-		go b.placeOrder(-float64(quote.AskSize)*b.tradeSz, math.Ceil(quote.AskPrice*b.pxFactor)/b.pxFactor)
+
+	b.orders.CancelAll()
+	return nil
+}
+
+// Flatten closes the whole position with a reduce-only market order.
+func (b *Binance) Flatten() error {
+	ctx, cancel := b.cleanupCtx()
+	defer cancel()
+
+	var pz float64
+	err := b.retry.Do(ctx, func() error {
+		var err error
+		pz, err = b.getPz()
+		return err
+	})
+	if err != nil {
+		return err
 	}
+	b.setPosition(pz)
+
+	qty := roundTo(pz, b.filters.StepSize)
+	if qty == 0 {
+		return nil
+	}
+
+	if err := b.placeMarketOrder(-qty); err != nil {
+		return err
+	}
+
+	// The stream may already be closed, so don't wait for its ACCOUNT_UPDATE
+	pz, err = b.getPz()
+	if err != nil {
+		return err
+	}
+	b.setPosition(pz)
+	return nil
+}
+
+func (b *Binance) position() float64 {
+	return math.Float64frombits(b.pz.Load())
+}
+
+func (b *Binance) setPosition(pz float64) {
+	b.pz.Store(math.Float64bits(pz))
+}
+
+func (b *Binance) placeMarketOrder(qty float64) error {
+	builder := builderPool.Get().(*strings.Builder)
+	builder.Reset()
+	defer builderPool.Put(builder)
+
+	builder.WriteString("type=MARKET")
+	builder.WriteString("&symbol=")
+	builder.WriteString(b.symbol)
+	builder.WriteString("&newClientOrderId=")
+	builder.WriteString(newClientID())
+	builder.WriteString("&quantity=")
+	if qty > 0 {
+		builder.WriteString(strconv.FormatFloat(qty, 'f', b.szPrecision, 64))
+		builder.WriteString("&side=BUY")
+	} else {
+		builder.WriteString(strconv.FormatFloat(-qty, 'f', b.szPrecision, 64))
+		builder.WriteString("&side=SELL")
+	}
+	builder.WriteString("&reduceOnly=true")
+	builder.WriteString("&recvWindow=500")
+	builder.WriteString("&timestamp=")
+	builder.WriteString(strconv.FormatInt(b.now(), 10))
+
+	totalParams := builder.String()
+	signature := b.signHmac(totalParams)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/order")
+	req.Header.Set("X-MBX-APIKEY", b.apiKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.SetMethod(fasthttp.MethodPost)
+
+	req.AppendBodyString(totalParams)
+	req.AppendBodyString("&signature=")
+	req.AppendBodyString(signature)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	return b.do("PlaceMarketOrder", req, resp, costFlatten)
 }
 
-func (b *Binance) placeOrder(qty float64, px float64) {
+func (b *Binance) placeOrder(qty float64, px float64) error {
+	b.sent.Add(1)
+
 	builder := builderPool.Get().(*strings.Builder)
 	builder.Reset()
 	defer builderPool.Put(builder)
@@ -101,6 +306,8 @@ func (b *Binance) placeOrder(qty float64, px float64) {
 	builder.WriteString("type=LIMIT")
 	builder.WriteString("&symbol=")
 	builder.WriteString(b.symbol)
+	builder.WriteString("&newClientOrderId=")
+	builder.WriteString(newClientID())
 	builder.WriteString("&quantity=")
 	if qty > 0 {
 		builder.WriteString(strconv.FormatFloat(qty, 'f', b.szPrecision, 64))
@@ -119,7 +326,7 @@ func (b *Binance) placeOrder(qty float64, px float64) {
 	}
 	builder.WriteString("&recvWindow=250")
 	builder.WriteString("&timestamp=")
-	builder.WriteString(strconv.FormatInt(time.Now().UnixMilli(), 10))
+	builder.WriteString(strconv.FormatInt(b.now(), 10))
 
 	totalParams := builder.String()
 	signature := b.signHmac(totalParams)
@@ -127,7 +334,7 @@ func (b *Binance) placeOrder(qty float64, px float64) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 
-	req.SetRequestURI("https://fapi.binance.com/fapi/v1/order")
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/order")
 	req.Header.Set("X-MBX-APIKEY", b.apiKey)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.SetMethod(fasthttp.MethodPost)
@@ -139,28 +346,25 @@ func (b *Binance) placeOrder(qty float64, px float64) {
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	err := b.client.Do(req, resp)
-	if err != nil {
-		panic(err)
-	}
-
-	body := resp.Body()
-	msg := gjson.GetBytes(body, "msg")
-
-	if msg.Exists() {
-		code := gjson.GetBytes(body, "code").Int()
-		slog.Error("PlaceOrder", "code", code, "msg", msg.Str, "params", totalParams)
-		if code == -5022 || code == -5028 || code == -1008 {
-			time.Sleep(500 * time.Millisecond)
-			b.placeOrder(qty, 0)
+	// Never blindly resend an order: a timed out request may have been accepted
+	err := b.do("PlaceOrder", req, resp, costOrder)
+	var e *Error
+	if errors.As(err, &e) {
+		slog.Error("PlaceOrder", "code", e.Code, "msg", e.Msg, "params", totalParams)
+		if e.Code == -5022 || e.Code == -5028 || e.Code == -1008 {
+			if !alpha.SleepCtx(b.ctx, 500*time.Millisecond) {
+				return err
+			}
+			return b.placeOrder(qty, 0)
 		}
-
-		// [TODO] might be mayday here
-		return
+		return err
 	}
+
+	b.orders.Track(gjson.ParseBytes(resp.Body()))
+	return nil
 }
 
-func (b *Binance) cancelOrders() {
+func (b *Binance) cancelOrders() error {
 	builder := builderPool.Get().(*strings.Builder)
 	builder.Reset()
 	defer builderPool.Put(builder)
@@ -169,14 +373,14 @@ func (b *Binance) cancelOrders() {
 	builder.WriteString(b.symbol)
 	builder.WriteString("&recvWindow=500")
 	builder.WriteString("&timestamp=")
-	builder.WriteString(strconv.FormatInt(time.Now().UnixMilli(), 10))
+	builder.WriteString(strconv.FormatInt(b.now(), 10))
 	totalParams := builder.String()
 	signature := b.signHmac(totalParams)
 
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 
-	req.SetRequestURI("https://fapi.binance.com/fapi/v1/allOpenOrders")
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/allOpenOrders")
 	req.Header.Set("X-MBX-APIKEY", b.apiKey)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.SetMethod(fasthttp.MethodDelete)
@@ -185,13 +389,45 @@ func (b *Binance) cancelOrders() {
 	req.AppendBodyString("&signature=")
 	req.AppendBodyString(signature)
 
-	err := b.client.Do(req, nil)
-	if err != nil {
-		panic(err)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	return b.do("CancelOrders", req, resp, costCancelAll)
+}
+
+func (b *Binance) getPz() (float64, error) {
+	builder := builderPool.Get().(*strings.Builder)
+	builder.Reset()
+	defer builderPool.Put(builder)
+
+	builder.WriteString("symbol=")
+	builder.WriteString(b.symbol)
+	builder.WriteString("&recvWindow=500")
+	builder.WriteString("&timestamp=")
+	builder.WriteString(strconv.FormatInt(b.now(), 10))
+	totalParams := builder.String()
+	signature := b.signHmac(totalParams)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI(b.profile.Rest + "/fapi/v3/positionRisk?" + totalParams + "&signature=" + signature)
+	req.Header.Set("X-MBX-APIKEY", b.apiKey)
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := b.do("GetPz", req, resp, costPosition); err != nil {
+		return 0, err
 	}
+
+	return gjson.GetBytes(resp.Body(), "0.positionAmt").Float(), nil
 }
 
-func (b *Binance) getPz() float64 {
+// getOpenOrders loads the orders resting on the exchange, including any
+// left by an earlier run, into the order book.
+func (b *Binance) getOpenOrders() error {
 	builder := builderPool.Get().(*strings.Builder)
 	builder.Reset()
 	defer builderPool.Put(builder)
@@ -200,104 +436,155 @@ func (b *Binance) getPz() float64 {
 	builder.WriteString(b.symbol)
 	builder.WriteString("&recvWindow=500")
 	builder.WriteString("&timestamp=")
-	builder.WriteString(strconv.FormatInt(time.Now().UnixMilli(), 10))
+	builder.WriteString(strconv.FormatInt(b.now(), 10))
 	totalParams := builder.String()
 	signature := b.signHmac(totalParams)
 
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 
-	req.SetRequestURI("https://fapi.binance.com/fapi/v3/positionRisk?" + totalParams + "&signature=" + signature)
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/openOrders?" + totalParams + "&signature=" + signature)
 	req.Header.Set("X-MBX-APIKEY", b.apiKey)
 	req.Header.SetMethod(fasthttp.MethodGet)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	err := b.client.Do(req, resp)
-	if err != nil {
-		panic(err)
+	if err := b.do("GetOpenOrders", req, resp, costOpenOrders); err != nil {
+		return err
 	}
 
-	body := resp.Body()
-	msg := gjson.GetBytes(body, "msg")
-	if msg.Exists() {
-		panic(msg.Str)
+	b.orders.Replace(gjson.ParseBytes(resp.Body()).Array())
+	return nil
+}
+
+// resync reloads the position and the resting orders, which the user data
+// stream only reports changes to.
+func (b *Binance) resync(ctx context.Context) error {
+	err := b.retry.Do(ctx, func() error {
+		pz, err := b.getPz()
+		if err == nil {
+			b.setPosition(pz)
+		}
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	return gjson.GetBytes(body, "0.positionAmt").Float()
+	return b.retry.Do(ctx, b.getOpenOrders)
 }
 
-func (b *Binance) getListenKey() string {
+func (b *Binance) getListenKey() (string, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 
-	req.SetRequestURI("https://fapi.binance.com/fapi/v1/listenKey")
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/listenKey")
 	req.Header.Set("X-MBX-APIKEY", b.apiKey)
 	req.Header.SetMethod(fasthttp.MethodPost)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	err := b.client.Do(req, resp)
-	if err != nil {
-		panic(err)
+	if err := b.do("GetListenKey", req, resp, costListenKey); err != nil {
+		return "", err
 	}
 
-	body := resp.Body()
-	msg := gjson.GetBytes(body, "msg")
-	if msg.Exists() {
-		panic(msg.Str)
-	}
-
-	return gjson.GetBytes(body, "listenKey").Str
+	return gjson.GetBytes(resp.Body(), "listenKey").Str, nil
 }
 
-func (b *Binance) extendListenKey() {
+func (b *Binance) extendListenKey() error {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 
-	req.SetRequestURI("https://fapi.binance.com/fapi/v1/listenKey")
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/listenKey")
 	req.Header.Set("X-MBX-APIKEY", b.apiKey)
 	req.Header.SetMethod(fasthttp.MethodPut)
 
-	err := b.client.Do(req, nil)
-	if err != nil {
-		panic(err)
-	}
-}
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
 
-func (b *Binance) wsUser() {
-	for {
-		listenKey := b.getListenKey()
+	return b.do("ExtendListenKey", req, resp, costListenKey)
+}
 
-		// Extend listen key every 55 minutes
-		ticker := time.NewTicker(55 * time.Minute)
-		go func() {
-			for range ticker.C {
-				b.extendListenKey()
-			}
-		}()
+func (b *Binance) wsUser(ctx context.Context) {
+	reconnect := false
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		var listenKey string
+		err := b.retry.Do(ctx, func() error {
+			var err error
+			listenKey, err = b.getListenKey()
+			return err
+		})
+		if err != nil {
+			slog.Error("wsUser", "GetListenKey", err)
+			alpha.SleepCtx(ctx, b.retry.Delay(attempt))
+			continue
+		}
 
-		urlStr := "wss://fstream.binance.com/ws/" + listenKey
-		c, _, err := websocket.DefaultDialer.Dial(urlStr, nil)
+		urlStr := b.profile.Stream + "/ws/" + listenKey
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, urlStr, nil)
 		if err != nil {
-			panic(err)
+			slog.Error("wsUser", "Dial", err)
+			alpha.SleepCtx(ctx, b.retry.Delay(attempt))
+			continue
 		}
+		attempt = 0
+
+		// Events sent while disconnected are lost, so start again from the
+		// exchange's state once the new stream is listening
+		if reconnect {
+			if err := b.resync(ctx); err != nil {
+				slog.Error("wsUser", "Resync", err)
+			}
+		}
+		reconnect = true
+
+		connCtx, cancel := context.WithCancel(ctx)
+		stop := context.AfterFunc(connCtx, func() { c.Close() })
+
+		// Extend listen key every 55 minutes
+		b.wg.Go(func() {
+			ticker := time.NewTicker(55 * time.Minute)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-connCtx.Done():
+					return
+				case <-ticker.C:
+					if err := b.retry.Do(connCtx, b.extendListenKey); err != nil {
+						slog.Error("wsUser", "ExtendListenKey", err)
+					}
+				}
+			}
+		})
 
 		for {
 			_, message, err := c.ReadMessage()
 			if err != nil {
-				slog.Error("wsUser", "ReadMessage", err)
+				if ctx.Err() == nil {
+					slog.Error("wsUser", "ReadMessage", err)
+				}
 				break
 			}
 
+			if b.recorder != nil {
+				b.recorder.Record("user", message)
+			}
+
 			eventResult := gjson.GetBytes(message, "e")
 			if !eventResult.Exists() {
 				continue
 			}
 
-			if eventResult.Str == "ACCOUNT_UPDATE" {
+			switch eventResult.Str {
+			case "ORDER_TRADE_UPDATE":
+				order := gjson.GetBytes(message, "o")
+				if order.Get("s").Str == b.symbol {
+					b.orders.Update(order)
+				}
+			case "ACCOUNT_UPDATE":
 				positions := gjson.GetBytes(message, "a.P")
 				if !positions.Exists() {
 					continue
@@ -305,16 +592,21 @@ func (b *Binance) wsUser() {
 
 				for _, position := range positions.Array() {
 					if position.Get("s").Str == b.symbol {
-						b.pz = position.Get("pa").Float()
+						b.setPosition(position.Get("pa").Float())
 						break
 					}
 				}
 			}
 		}
 
-		ticker.Stop()
+		stop()
+		cancel()
+		c.Close()
+		if ctx.Err() != nil {
+			return
+		}
 
 		slog.Info("wsUser", "disconnected", "reconnect in a sec")
-		time.Sleep(time.Second)
+		alpha.SleepCtx(ctx, time.Second)
 	}
 }
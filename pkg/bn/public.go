@@ -1,6 +1,7 @@
 package bn
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"mm/pkg/alpha"
@@ -13,38 +14,77 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
-func FetchKlines(symbol, interval string, limit int, endTime string) []alpha.Candle {
-	client := &fasthttp.Client{}
+const maxKlinesLimit = 1500
+
+func (b *Binance) FetchKlines(symbol, interval string, limit int, endTime string) ([]alpha.Candle, error) {
+	end := int64(0)
+	if endTime != "" {
+		t, err := time.Parse(time.RFC3339, endTime)
+		if err != nil {
+			return nil, err
+		}
+		end = t.UnixMilli()
+	}
+
+	// Page backwards from end until limit bars are collected or history runs out
+	candles := make([]alpha.Candle, 0, limit)
+	for len(candles) < limit {
+		var page []alpha.Candle
+		err := b.retry.Do(b.ctx, func() error {
+			var err error
+			page, err = b.fetchKlinesPage(symbol, interval, min(limit-len(candles), maxKlinesLimit), end)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		n := len(candles)
+		candles = alpha.MergeCandles(page, candles)
+		if len(candles) == n {
+			break
+		}
+		end = page[0].Time - 1
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	return candles, nil
+}
+
+func (b *Binance) fetchKlinesPage(symbol, interval string, limit int, end int64) ([]alpha.Candle, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	req.SetRequestURI("https://fapi.binance.com/fapi/v1/klines")
+	req.SetRequestURI(b.profile.Rest + "/fapi/v1/klines")
 	req.Header.SetMethod(fasthttp.MethodGet)
 	queryArgs := req.URI().QueryArgs()
 	queryArgs.Set("symbol", symbol)
 	queryArgs.Set("interval", interval)
-	queryArgs.Set("limit", strconv.Itoa(min(limit, 1500)))
-	if endTime != "" {
-		t, err := time.Parse(time.RFC3339, endTime)
-		if err != nil {
-			panic(err)
-		}
-		queryArgs.Set("endTime", strconv.FormatInt(t.UnixMilli(), 10))
+	queryArgs.Set("limit", strconv.Itoa(limit))
+	if end > 0 {
+		queryArgs.Set("endTime", strconv.FormatInt(end, 10))
 	}
-	if err := client.Do(req, resp); err != nil {
-		panic(err)
+	if err := b.do("FetchKlines", req, resp, klinesCost(limit)); err != nil {
+		return nil, err
 	}
 
 	jsonResult := gjson.ParseBytes(resp.Body())
 	if !jsonResult.IsArray() {
-		panic("unexpected kline response format")
+		return nil, &Error{Kind: ErrReject, Op: "FetchKlines", Msg: "unexpected kline response format"}
 	}
 
-	candles := make([]alpha.Candle, limit)
+	rows := jsonResult.Array()
+	candles := make([]alpha.Candle, len(rows))
 
-	for i, v := range jsonResult.Array() {
+	for i, v := range rows {
 		row := v.Array()
 
 		candles[i] = alpha.Candle{
@@ -57,38 +97,65 @@ func FetchKlines(symbol, interval string, limit int, endTime string) []alpha.Can
 		}
 	}
 
-	return candles
+	return candles, nil
 }
 
-func WsKline(symbol string, onTick func(alpha.Candle)) {
-	wsURL := fmt.Sprintf("wss://fstream.binance.com/ws/%s@kline_1m", strings.ToLower(symbol))
+// WsKline streams kline updates to onTick until ctx is done, reconnecting
+// on errors.
+func (b *Binance) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	wsURL := fmt.Sprintf("%s/ws/%s@kline_%s", b.profile.Stream, strings.ToLower(symbol), interval)
 
-	for {
-		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
 		if err != nil {
-			panic(err)
+			slog.Error("WsKline", "Dial", err)
+			alpha.SleepCtx(ctx, b.retry.Delay(attempt))
+			continue
 		}
+		attempt = 0
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
 
 		for {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
-				slog.Error("WsBbo", "WebSocket read error", err)
+				if ctx.Err() == nil {
+					slog.Error("WsBbo", "WebSocket read error", err)
+				}
 				conn.Close()
 				break
 			}
 
-			k := gjson.GetBytes(message, "k")
-			onTick(alpha.Candle{
-				Time:   k.Get("t").Int(),
-				Open:   k.Get("o").Float(),
-				High:   k.Get("h").Float(),
-				Low:    k.Get("l").Float(),
-				Close:  k.Get("c").Float(),
-				Volume: k.Get("v").Float(),
-			})
+			if b.recorder != nil {
+				b.recorder.Record("kline", message)
+			}
+			if c, ok := ParseKline(message); ok {
+				onTick(c)
+			}
+		}
+
+		stop()
+		if ctx.Err() != nil {
+			return
 		}
 
 		slog.Info("WsBbo", "disconnected", "reconnect in a sec")
-		time.Sleep(time.Second)
+		alpha.SleepCtx(ctx, time.Second)
 	}
 }
+
+// ParseKline reads the candle from a kline stream frame.
+func ParseKline(frame []byte) (alpha.Candle, bool) {
+	k := gjson.GetBytes(frame, "k")
+	if !k.Exists() {
+		return alpha.Candle{}, false
+	}
+
+	return alpha.Candle{
+		Time:   k.Get("t").Int(),
+		Open:   k.Get("o").Float(),
+		High:   k.Get("h").Float(),
+		Low:    k.Get("l").Float(),
+		Close:  k.Get("c").Float(),
+		Volume: k.Get("v").Float(),
+	}, true
+}
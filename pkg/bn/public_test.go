@@ -0,0 +1,72 @@
+package bn_test
+
+import (
+	"context"
+	"testing"
+
+	"mm/pkg/alpha"
+	"mm/pkg/bn"
+	"mm/pkg/bn/bntest"
+)
+
+// connect syncs a Binance venue against srv. The returned stop cancels the
+// session and waits for its streams, as runLive does before cleaning up.
+func connect(t *testing.T, srv *bntest.Server) (*bn.Binance, func()) {
+	t.Helper()
+	t.Setenv("BINANCE_API_KEY", srv.APIKey)
+	t.Setenv("BINANCE_SECRET_KEY", srv.SecretKey)
+
+	b, err := bn.NewBinance(&alpha.Params{
+		Symbol:      "BTCUSDT",
+		LotSize:     1,
+		TradeSz:     0.001,
+		PxPrecision: 1,
+		SzPrecision: 3,
+		Profile:     "custom",
+		RestURL:     srv.URLs.Rest,
+		StreamURL:   srv.URLs.Stream,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := b.Sync(ctx, "BTCUSDT"); err != nil {
+		cancel()
+		t.Fatalf("Sync: %v", err)
+	}
+	return b, func() {
+		cancel()
+		b.Wait()
+	}
+}
+
+// TestFetchKlinesPages asks for more bars than one request may return.
+func TestFetchKlinesPages(t *testing.T) {
+	const step = 60_000
+	history := make([]alpha.Candle, 4000)
+	for i := range history {
+		history[i] = alpha.Candle{Time: 1_700_000_000_000 + int64(i)*step, Open: 60000, High: 60010, Low: 59990, Close: 60000}
+	}
+	srv := bntest.NewServer("BTCUSDT", "1m", history)
+	defer srv.Close()
+
+	b, stop := connect(t, srv)
+	defer stop()
+
+	candles, err := b.FetchKlines("BTCUSDT", "1m", 3200, "")
+	if err != nil {
+		t.Fatalf("FetchKlines: %v", err)
+	}
+	if len(candles) != 3200 {
+		t.Fatalf("got %d bars, want 3200", len(candles))
+	}
+	if last := candles[len(candles)-1].Time; last != history[len(history)-1].Time {
+		t.Errorf("last bar at %d, want %d", last, history[len(history)-1].Time)
+	}
+	for i := 1; i < len(candles); i++ {
+		if d := candles[i].Time - candles[i-1].Time; d != step {
+			t.Fatalf("bars %d and %d are %dms apart, want %d", i-1, i, d, step)
+		}
+	}
+}
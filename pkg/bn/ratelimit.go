@@ -0,0 +1,263 @@
+package bn
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/valyala/fasthttp"
+)
+
+// Futures limits: request weight is per IP, order counts per account.
+const (
+	weightPerMinute   = 2400
+	ordersPer10s      = 300
+	ordersPerMinute   = 1200
+	maxQuoteDelay     = time.Second
+	defaultBanBackoff = time.Minute
+)
+
+type cost struct {
+	weight int
+	orders int
+	// essential requests (cancels, position, market data) wait for tokens,
+	// others such as new quotes are dropped when the wait is too long
+	essential bool
+}
+
+var (
+	costOrder       = cost{weight: 1, orders: 1}
+	costCancel      = cost{weight: 1, essential: true}
+	costFlatten     = cost{weight: 1, orders: 1, essential: true}
+	costCancelAll   = cost{weight: 1, essential: true}
+	costOpenOrders  = cost{weight: 1, essential: true}
+	costBatchOrders = cost{weight: 5}
+	costPosition    = cost{weight: 5, essential: true}
+	costListenKey   = cost{weight: 1, essential: true}
+)
+
+// klinesCost follows the weight table of /fapi/v1/klines.
+func klinesCost(limit int) cost {
+	switch {
+	case limit < 100:
+		return cost{weight: 1, essential: true}
+	case limit < 500:
+		return cost{weight: 2, essential: true}
+	case limit <= 1000:
+		return cost{weight: 5, essential: true}
+	}
+	return cost{weight: 10, essential: true}
+}
+
+type bucket struct {
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newBucket(capacity float64, per time.Duration) *bucket {
+	return &bucket{
+		capacity: capacity,
+		rate:     capacity / per.Seconds(),
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait is how long until n tokens are available.
+func (b *bucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// sync lowers the local balance to what the server says is left.
+func (b *bucket) sync(used float64) {
+	b.tokens = min(b.tokens, b.capacity-used)
+}
+
+// Limiter is a client-side token bucket per limit class kept in line with
+// the usage the exchange reports back. One limiter is shared by every
+// Binance instance of the process as weight is counted per IP.
+type Limiter struct {
+	mu          sync.Mutex
+	weight      *bucket
+	orders10s   *bucket
+	orders1m    *bucket
+	bannedUntil time.Time
+	stats       LimiterStats
+}
+
+type LimiterStats struct {
+	UsedWeight int64
+	Throttled  int64
+	Dropped    int64
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		weight:    newBucket(weightPerMinute, time.Minute),
+		orders10s: newBucket(ordersPer10s, 10*time.Second),
+		orders1m:  newBucket(ordersPerMinute, time.Minute),
+	}
+}
+
+var DefaultLimiter = NewLimiter()
+
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Acquire takes the tokens for a request, sleeping if needed. Non-essential
+// requests that would wait longer than maxQuoteDelay fail with ErrRateLimit.
+func (l *Limiter) Acquire(op string, c cost) error {
+	l.mu.Lock()
+
+	now := time.Now()
+	if now.Before(l.bannedUntil) {
+		retryAfter := l.bannedUntil.Sub(now)
+		l.mu.Unlock()
+		return &Error{Kind: ErrRateLimit, Op: op, Msg: "backing off after 429/418", RetryAfter: retryAfter}
+	}
+
+	l.weight.refill(now)
+	l.orders10s.refill(now)
+	l.orders1m.refill(now)
+
+	delay := l.weight.wait(float64(c.weight))
+	if c.orders > 0 {
+		delay = max(delay, l.orders10s.wait(float64(c.orders)), l.orders1m.wait(float64(c.orders)))
+	}
+	if delay > maxQuoteDelay && !c.essential {
+		l.stats.Dropped++
+		l.mu.Unlock()
+		return &Error{Kind: ErrRateLimit, Op: op, Msg: "dropped by client rate limiter", RetryAfter: delay}
+	}
+
+	l.weight.tokens -= float64(c.weight)
+	l.orders10s.tokens -= float64(c.orders)
+	l.orders1m.tokens -= float64(c.orders)
+	if delay > 0 {
+		l.stats.Throttled++
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// Observe syncs the buckets with the X-MBX-* usage headers and starts a
+// back-off on 429 (too many requests) and 418 (IP banned).
+func (l *Limiter) Observe(resp *fasthttp.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if used, err := strconv.ParseInt(string(resp.Header.Peek("X-MBX-USED-WEIGHT-1M")), 10, 64); err == nil {
+		l.weight.refill(now)
+		l.weight.sync(float64(used))
+		l.stats.UsedWeight = used
+	}
+	if used, err := strconv.ParseInt(string(resp.Header.Peek("X-MBX-ORDER-COUNT-10S")), 10, 64); err == nil {
+		l.orders10s.refill(now)
+		l.orders10s.sync(float64(used))
+	}
+	if used, err := strconv.ParseInt(string(resp.Header.Peek("X-MBX-ORDER-COUNT-1M")), 10, 64); err == nil {
+		l.orders1m.refill(now)
+		l.orders1m.sync(float64(used))
+	}
+
+	status := resp.StatusCode()
+	if status != fasthttp.StatusTooManyRequests && status != fasthttp.StatusTeapot {
+		return
+	}
+
+	backoff := defaultBanBackoff
+	if secs, err := strconv.Atoi(string(resp.Header.Peek("Retry-After"))); err == nil {
+		backoff = time.Duration(secs) * time.Second
+	}
+	l.backoff(now.Add(backoff))
+}
+
+func (l *Limiter) backoff(until time.Time) {
+	if until.After(l.bannedUntil) {
+		l.bannedUntil = until
+	}
+}
+
+// Backoff stops all requests for d, for limits hit outside of REST.
+func (l *Limiter) Backoff(d time.Duration) {
+	if d <= 0 {
+		d = defaultBanBackoff
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.backoff(time.Now().Add(d))
+}
+
+// ObserveWs syncs the buckets with the rateLimits array of a WebSocket API
+// response.
+func (l *Limiter) ObserveWs(rateLimits gjson.Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, rl := range rateLimits.Array() {
+		count := rl.Get("count").Float()
+		interval := rl.Get("interval").Str
+		switch rl.Get("rateLimitType").Str {
+		case "REQUEST_WEIGHT":
+			l.weight.refill(now)
+			l.weight.sync(count)
+			l.stats.UsedWeight = int64(count)
+		case "ORDERS":
+			if interval == "SECOND" {
+				l.orders10s.refill(now)
+				l.orders10s.sync(count)
+			} else {
+				l.orders1m.refill(now)
+				l.orders1m.sync(count)
+			}
+		}
+	}
+}
+
+// do runs a REST request through the limiter and checks its response.
+func (b *Binance) do(op string, req *fasthttp.Request, resp *fasthttp.Response, c cost) error {
+	if err := b.limiter.Acquire(op, c); err != nil {
+		return err
+	}
+
+	if err := b.client.Do(req, resp); err != nil {
+		return networkError(op, err)
+	}
+	b.limiter.Observe(resp)
+
+	err := checkResponse(op, resp)
+	var e *Error
+	if errors.As(err, &e) && e.Code == -1021 && b.clock.resync.CompareAndSwap(false, true) {
+		// Timestamp outside recvWindow, the clock drifted since the last sync.
+		// Resync before returning so the caller's next attempt is signed right.
+		if err := b.syncClock(); err != nil {
+			slog.Error("Clock", "sync", err)
+		}
+		b.clock.resync.Store(false)
+	}
+
+	return err
+}
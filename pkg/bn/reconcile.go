@@ -0,0 +1,185 @@
+package bn
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"mm/pkg/alpha"
+	"sync"
+	"time"
+)
+
+type target struct {
+	side   string
+	qty    float64
+	px     float64
+	active bool
+}
+
+type plan struct {
+	cancels  []string
+	modifies []orderReq
+	places   []orderReq
+}
+
+// Apply reconciles the resting orders with quote: an order within the
+// requote tolerance is left alone to keep its queue position, a stale one
+// is amended in place, and only surplus orders are cancelled. Each kind of
+// change goes out as a single batch request.
+func (b *Binance) Apply(quote alpha.Quote) error {
+	bid := target{
+		side:   "BUY",
+		active: quote.BidActive && quote.BidSize > 0 && !math.IsNaN(quote.BidPrice),
+	}
+	if bid.active {
+		bid.qty = roundTo(quote.BidSize, b.filters.StepSize)
+		bid.px = floorTo(quote.BidPrice, b.filters.TickSize)
+		bid.active = b.checkNotional(bid)
+	}
+
+	ask := target{
+		side:   "SELL",
+		active: quote.AskActive && quote.AskSize > 0 && !math.IsNaN(quote.AskPrice),
+	}
+	if ask.active {
+		ask.qty = roundTo(quote.AskSize, b.filters.StepSize)
+		ask.px = ceilTo(quote.AskPrice, b.filters.TickSize)
+		ask.active = b.checkNotional(ask)
+	}
+
+	resting := b.orders.Open()
+
+	var p plan
+	b.plan(&p, bid, resting)
+	b.plan(&p, ask, resting)
+
+	return b.execute(p)
+}
+
+// checkNotional drops a quote leg the exchange would reject as too small.
+func (b *Binance) checkNotional(t target) bool {
+	if t.qty <= 0 || t.px <= 0 {
+		slog.Warn("Apply", "side", t.side, "qty", t.qty, "px", t.px, "err", "non-positive order")
+		return false
+	}
+	if t.qty*t.px < b.filters.MinNotional {
+		slog.Warn("Apply", "side", t.side, "notional", t.qty*t.px, "minNotional", b.filters.MinNotional)
+		return false
+	}
+	return true
+}
+
+func (b *Binance) plan(p *plan, t target, resting []LiveOrder) {
+	var keep *LiveOrder
+	for i := range resting {
+		order := &resting[i]
+		if order.Side != side(t.side) {
+			continue
+		}
+		if t.active && keep == nil {
+			keep = order
+			continue
+		}
+		p.cancels = append(p.cancels, order.ClientID)
+	}
+
+	switch {
+	case !t.active:
+	case keep == nil:
+		p.places = append(p.places, orderReq{clientID: newClientID(), side: t.side, qty: t.qty, px: t.px})
+	case math.Abs(keep.Price-t.px) <= (float64(b.requoteTicks)+0.5)*b.filters.TickSize &&
+		math.Abs(keep.Qty-keep.FilledQty-t.qty) < 0.5*b.filters.StepSize:
+	default:
+		p.modifies = append(p.modifies, orderReq{clientID: keep.ClientID, side: t.side, qty: keep.FilledQty + t.qty, px: t.px})
+	}
+}
+
+func (b *Binance) execute(p plan) error {
+	var (
+		wg          sync.WaitGroup
+		cancelErr   error
+		modifyErr   error
+		placeErr    error
+		modFailed   map[int]*Error
+		placeFailed map[int]*Error
+	)
+	if len(p.cancels) > 0 {
+		wg.Go(func() { cancelErr = b.sendCancels(p.cancels) })
+	}
+	if len(p.modifies) > 0 {
+		wg.Go(func() { modFailed, modifyErr = b.sendModifies(p.modifies) })
+	}
+	if len(p.places) > 0 {
+		wg.Go(func() { placeFailed, placeErr = b.sendPlaces(p.places) })
+	}
+	wg.Wait()
+
+	errs := []error{cancelErr, modifyErr, placeErr}
+
+	// Filled or expired in the meantime, start over with fresh orders
+	var retry plan
+	for i, e := range modFailed {
+		req := p.modifies[i]
+		slog.Warn("ModifyBatch", "clientId", req.clientID, "err", e)
+		retry.cancels = append(retry.cancels, req.clientID)
+		retry.places = append(retry.places, orderReq{clientID: newClientID(), side: req.side, qty: req.qty, px: req.px})
+	}
+	if len(retry.cancels) > 0 {
+		errs = append(errs, b.sendCancels(retry.cancels))
+		failed, err := b.sendPlaces(retry.places)
+		errs = append(errs, err)
+		for i, e := range failed {
+			errs = append(errs, b.placeFallback(retry.places[i], e))
+		}
+	}
+
+	for i, e := range placeFailed {
+		errs = append(errs, b.placeFallback(p.places[i], e))
+	}
+
+	return errors.Join(errs...)
+}
+
+// placeFallback rests a rejected post-only order at the queue price instead,
+// as placeOrder does for single orders.
+func (b *Binance) placeFallback(req orderReq, e *Error) error {
+	slog.Error("PlaceBatch", "code", e.Code, "msg", e.Msg, "clientId", req.clientID)
+	if e.Code != -5022 && e.Code != -5028 && e.Code != -1008 {
+		return e
+	}
+
+	if !alpha.SleepCtx(b.ctx, 500*time.Millisecond) {
+		return e
+	}
+	qty := req.qty
+	if req.side == "SELL" {
+		qty = -qty
+	}
+	return b.placeOrder(qty, 0)
+}
+
+// The WebSocket API is used when configured and connected, REST batches
+// otherwise.
+func (b *Binance) sendPlaces(reqs []orderReq) (map[int]*Error, error) {
+	b.sent.Add(int64(len(reqs)))
+	if b.ws != nil && b.ws.ready() {
+		return b.ws.place(reqs)
+	}
+	return b.placeBatch(reqs)
+}
+
+func (b *Binance) sendModifies(reqs []orderReq) (map[int]*Error, error) {
+	b.sent.Add(int64(len(reqs)))
+	if b.ws != nil && b.ws.ready() {
+		return b.ws.modify(reqs)
+	}
+	return b.modifyBatch(reqs)
+}
+
+func (b *Binance) sendCancels(clientIDs []string) error {
+	b.sent.Add(int64(len(clientIDs)))
+	if b.ws != nil && b.ws.ready() {
+		return b.ws.cancel(clientIDs)
+	}
+	return b.cancelBatch(clientIDs)
+}
@@ -0,0 +1,72 @@
+package bn_test
+
+import (
+	"testing"
+	"time"
+
+	"mm/pkg/alpha"
+	"mm/pkg/bn/bntest"
+)
+
+var twoSided = alpha.Quote{BidPrice: 59000, BidSize: 0.001, BidActive: true, AskPrice: 61000, AskSize: 0.001, AskActive: true, Valid: true}
+
+// TestSyncLoadsRestingOrders restarts over orders a previous run left on the
+// book, which must be requoted rather than doubled.
+func TestSyncLoadsRestingOrders(t *testing.T) {
+	srv := bntest.NewServer("BTCUSDT", "1m", []alpha.Candle{{Time: 1_700_000_000_000, Close: 60000}})
+	defer srv.Close()
+
+	first, stop := connect(t, srv)
+	if err := first.Apply(twoSided); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	stop()
+
+	b, stop := connect(t, srv)
+	defer stop()
+	if n := len(b.Orders().Open()); n != 2 {
+		t.Fatalf("%d orders loaded on Sync, want 2", n)
+	}
+	if err := b.Apply(twoSided); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if n := len(srv.Open()); n != 2 {
+		t.Errorf("%d orders resting after requote, want 2", n)
+	}
+}
+
+// TestResyncAfterReconnect fills the bid while the user data stream is down
+// and checks the reconnect picks up both the order and the position.
+func TestResyncAfterReconnect(t *testing.T) {
+	srv := bntest.NewServer("BTCUSDT", "1m", []alpha.Candle{{Time: 1_700_000_000_000, Close: 60000}})
+	defer srv.Close()
+
+	b, stop := connect(t, srv)
+	defer stop()
+	if err := b.Apply(twoSided); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	waitUsers(t, srv, 1)
+	srv.DropUserStreams()
+	srv.Bar(alpha.Candle{Time: 1_700_000_060_000, Open: 60000, High: 60000, Low: 58900, Close: 59000})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Inventory() != 0.001 || len(b.Orders().Open()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("inventory %g with %d open orders after reconnect, want 0.001 and 1", b.Inventory(), len(b.Orders().Open()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitUsers(t *testing.T, srv *bntest.Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, users := srv.Streams(); users != n; _, users = srv.Streams() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d user streams connected, want %d", users, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,31 @@
+package bn_test
+
+import (
+	"testing"
+
+	"mm/pkg/alpha"
+	"mm/pkg/bn/bntest"
+)
+
+func TestCancelRetriesAfterShutdown(t *testing.T) {
+	srv := bntest.NewServer("BTCUSDT", "1m", []alpha.Candle{{Time: 1_700_000_000_000, Close: 60000}})
+	defer srv.Close()
+
+	b, stop := connect(t, srv)
+	err := b.Apply(alpha.Quote{BidPrice: 59000, BidSize: 0.001, BidActive: true, AskPrice: 61000, AskSize: 0.001, AskActive: true, Valid: true})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if n := len(srv.Open()); n != 2 {
+		t.Fatalf("%d orders resting, want 2", n)
+	}
+
+	stop()
+	srv.FailNext("DELETE", "/fapi/v1/allOpenOrders", 1)
+	if err := b.Cancel(); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if open := srv.Open(); len(open) != 0 {
+		t.Errorf("%d orders left after shutdown, want none", len(open))
+	}
+}
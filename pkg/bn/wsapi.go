@@ -0,0 +1,371 @@
+package bn
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mm/pkg/alpha"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/tidwall/gjson"
+)
+
+const wsAPITimeout = 5 * time.Second
+
+var errWsAPIDown = errors.New("websocket api not connected")
+
+// wsAPI places orders over the futures WebSocket API on one persistent
+// connection, matching responses to requests by id. With an Ed25519 key the
+// session logs on once, otherwise every request carries an HMAC signature.
+type wsAPI struct {
+	b      *Binance
+	url    string
+	edKey  ed25519.PrivateKey
+	logged atomic.Bool
+	seq    atomic.Uint64
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	pending map[string]chan gjson.Result
+}
+
+func newWsAPI(b *Binance, url string) (*wsAPI, error) {
+	w := &wsAPI{
+		b:       b,
+		url:     url,
+		pending: make(map[string]chan gjson.Result),
+	}
+
+	if path := strings.TrimSpace(os.Getenv(b.profile.Ed25519KeyEnv)); path != "" {
+		key, err := loadEd25519(path)
+		if err != nil {
+			return nil, &Error{Kind: ErrAuth, Op: "WsAPI", Err: err}
+		}
+		w.edKey = key
+	}
+
+	return w, nil
+}
+
+func loadEd25519(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+func (w *wsAPI) ready() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn != nil
+}
+
+// run keeps the connection up until ctx is done.
+func (w *wsAPI) run(ctx context.Context) {
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, w.url, nil)
+		if err != nil {
+			slog.Error("WsAPI", "Dial", err)
+			alpha.SleepCtx(ctx, w.b.retry.Delay(attempt))
+			continue
+		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+		w.mu.Lock()
+		w.conn = conn
+		w.mu.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			w.read(conn)
+		}()
+
+		if w.edKey != nil {
+			if err := w.logon(); err != nil {
+				slog.Error("WsAPI", "Logon", err)
+				conn.Close()
+			} else {
+				attempt = 0
+			}
+		} else {
+			attempt = 0
+		}
+
+		<-done
+		stop()
+		w.logged.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Info("WsAPI", "disconnected", "reconnect in a sec")
+		alpha.SleepCtx(ctx, w.b.retry.Delay(attempt))
+	}
+}
+
+// read dispatches responses until the connection fails, then fails every
+// request still waiting.
+func (w *wsAPI) read(conn *websocket.Conn) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if w.b.recorder != nil {
+			w.b.recorder.Record("wsapi", message)
+		}
+
+		msg := gjson.ParseBytes(message)
+		id := msg.Get("id").String()
+
+		w.mu.Lock()
+		ch, ok := w.pending[id]
+		delete(w.pending, id)
+		w.mu.Unlock()
+
+		if ok {
+			ch <- msg
+		}
+	}
+
+	w.mu.Lock()
+	w.conn = nil
+	for id, ch := range w.pending {
+		close(ch)
+		delete(w.pending, id)
+	}
+	w.mu.Unlock()
+	conn.Close()
+}
+
+func (w *wsAPI) logon() error {
+	params := map[string]string{
+		"apiKey":    w.b.apiKey,
+		"timestamp": strconv.FormatInt(w.b.now(), 10),
+	}
+	params["signature"] = base64.StdEncoding.EncodeToString(ed25519.Sign(w.edKey, []byte(encodeParams(params))))
+
+	if _, err := w.send("session.logon", params); err != nil {
+		return err
+	}
+
+	w.logged.Store(true)
+	return nil
+}
+
+// call signs params unless the session is logged on and sends them.
+func (w *wsAPI) call(method string, params map[string]string, c cost) (gjson.Result, error) {
+	if err := w.b.limiter.Acquire(method, c); err != nil {
+		return gjson.Result{}, err
+	}
+
+	params["timestamp"] = strconv.FormatInt(w.b.now(), 10)
+	if !w.logged.Load() {
+		params["apiKey"] = w.b.apiKey
+		params["signature"] = w.b.signHmac(encodeParams(params))
+	}
+
+	return w.send(method, params)
+}
+
+func (w *wsAPI) send(method string, params map[string]string) (gjson.Result, error) {
+	id := strconv.FormatUint(w.seq.Add(1), 10)
+	msg, err := json.Marshal(map[string]any{
+		"id":     id,
+		"method": method,
+		"params": params,
+	})
+	if err != nil {
+		return gjson.Result{}, err
+	}
+
+	ch := make(chan gjson.Result, 1)
+
+	w.mu.Lock()
+	if w.conn == nil {
+		w.mu.Unlock()
+		return gjson.Result{}, networkError(method, errWsAPIDown)
+	}
+	w.pending[id] = ch
+	err = w.conn.WriteMessage(websocket.TextMessage, msg)
+	if err != nil {
+		delete(w.pending, id)
+	}
+	w.mu.Unlock()
+
+	if err != nil {
+		return gjson.Result{}, networkError(method, err)
+	}
+
+	timer := time.NewTimer(wsAPITimeout)
+	defer timer.Stop()
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return gjson.Result{}, networkError(method, errWsAPIDown)
+		}
+		w.b.limiter.ObserveWs(resp.Get("rateLimits"))
+		if status := resp.Get("status").Int(); status != 200 {
+			e := &Error{
+				Op:     method,
+				Status: int(status),
+				Code:   resp.Get("error.code").Int(),
+				Msg:    resp.Get("error.msg").Str,
+			}
+			if retryAfter := resp.Get("error.data.retryAfter").Int(); retryAfter > 0 {
+				e.RetryAfter = time.Until(time.UnixMilli(retryAfter))
+			}
+			if status == 429 || status == 418 {
+				w.b.limiter.Backoff(e.RetryAfter)
+			}
+			return gjson.Result{}, classify(e)
+		}
+		return resp.Get("result"), nil
+	case <-timer.C:
+		w.mu.Lock()
+		delete(w.pending, id)
+		w.mu.Unlock()
+		return gjson.Result{}, networkError(method, errors.New("request timed out"))
+	}
+}
+
+// each runs one WebSocket API request per item concurrently and gathers
+// the per-item rejections like a batch endpoint would.
+func (w *wsAPI) each(n int, method string, c cost, params func(i int) map[string]string) (map[int]*Error, error) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	failed := make(map[int]*Error)
+
+	for i := range n {
+		wg.Go(func() {
+			result, err := w.call(method, params(i), c)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			var e *Error
+			switch {
+			case errors.As(err, &e) && e.Kind == ErrReject:
+				failed[i] = e
+			case err != nil:
+				errs = append(errs, err)
+			default:
+				w.b.orders.Track(result)
+			}
+		})
+	}
+	wg.Wait()
+
+	return failed, errors.Join(errs...)
+}
+
+func (w *wsAPI) place(reqs []orderReq) (map[int]*Error, error) {
+	return w.each(len(reqs), "order.place", costOrder, func(i int) map[string]string {
+		r := reqs[i]
+		return map[string]string{
+			"symbol":           w.b.symbol,
+			"type":             "LIMIT",
+			"timeInForce":      "GTX",
+			"newClientOrderId": r.clientID,
+			"side":             r.side,
+			"quantity":         strconv.FormatFloat(r.qty, 'f', w.b.szPrecision, 64),
+			"price":            strconv.FormatFloat(r.px, 'f', w.b.pxPrecision, 64),
+		}
+	})
+}
+
+func (w *wsAPI) modify(reqs []orderReq) (map[int]*Error, error) {
+	failed, err := w.each(len(reqs), "order.modify", costOrder, func(i int) map[string]string {
+		r := reqs[i]
+		return map[string]string{
+			"symbol":            w.b.symbol,
+			"origClientOrderId": r.clientID,
+			"side":              r.side,
+			"quantity":          strconv.FormatFloat(r.qty, 'f', w.b.szPrecision, 64),
+			"price":             strconv.FormatFloat(r.px, 'f', w.b.pxPrecision, 64),
+		}
+	})
+
+	for i, e := range failed {
+		// No need to modify the order
+		if e.Code == -5027 {
+			delete(failed, i)
+		}
+	}
+
+	return failed, err
+}
+
+func (w *wsAPI) cancel(clientIDs []string) error {
+	failed, err := w.each(len(clientIDs), "order.cancel", costCancel, func(i int) map[string]string {
+		return map[string]string{
+			"symbol":            w.b.symbol,
+			"origClientOrderId": clientIDs[i],
+		}
+	})
+
+	errs := []error{err}
+	for i, e := range failed {
+		if e.Code == -2011 {
+			w.b.orders.Drop(clientIDs[i])
+			continue
+		}
+		errs = append(errs, e)
+	}
+
+	return errors.Join(errs...)
+}
+
+// encodeParams joins params sorted by key as the signature payload.
+func encodeParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(params[k])
+	}
+	return sb.String()
+}
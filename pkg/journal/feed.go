@@ -0,0 +1,28 @@
+package journal
+
+import (
+	"context"
+	"log/slog"
+	"mm/pkg/alpha"
+)
+
+// Feed replays the kline stream of a journal in place of the live one of
+// Venue, through the venue's own frame parser. WsKline returns at the end
+// of the journal.
+type Feed struct {
+	alpha.Venue
+	Path  string
+	Speed float64
+	Parse func(frame []byte) (alpha.Candle, bool)
+}
+
+func (f *Feed) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	err := Replay(ctx, f.Path, "kline", f.Speed, func(frame Frame) {
+		if c, ok := f.Parse([]byte(frame.Data)); ok {
+			onTick(c)
+		}
+	})
+	if err != nil {
+		slog.Error("Replay", "path", f.Path, "err", err)
+	}
+}
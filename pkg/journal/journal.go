@@ -0,0 +1,191 @@
+// Package journal records raw websocket frames to a gzip compressed file and
+// plays them back with their original timing.
+//
+// A journal is a gzip stream of JSON lines, one per frame:
+//
+//	{"t":1700000000123456789,"s":"kline","d":"{\"e\":\"kline\",...}"}
+//
+// with the receive time in Unix nanoseconds, the stream name and the frame
+// as received.
+package journal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const flushInterval = time.Second
+
+// Recorder is implemented by anything that can keep raw frames.
+type Recorder interface {
+	Record(stream string, frame []byte)
+}
+
+type Frame struct {
+	Time   int64  `json:"t"`
+	Stream string `json:"s"`
+	Data   string `json:"d"`
+}
+
+// Writer appends frames to a journal file. It is safe for concurrent use
+// and flushes at most once a second, so a crash loses about that much.
+type Writer struct {
+	mu      sync.Mutex
+	f       *os.File
+	gz      *gzip.Writer
+	enc     *json.Encoder
+	flushed time.Time
+	err     error
+}
+
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(f)
+	return &Writer{
+		f:       f,
+		gz:      gz,
+		enc:     json.NewEncoder(gz),
+		flushed: time.Now(),
+	}, nil
+}
+
+// Record writes frame as received now. The first write error is logged and
+// stops recording, it never interrupts the stream being recorded.
+func (w *Writer) Record(stream string, frame []byte) {
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	w.err = w.enc.Encode(Frame{Time: now.UnixNano(), Stream: stream, Data: string(frame)})
+	if w.err == nil && now.Sub(w.flushed) >= flushInterval {
+		w.err = w.gz.Flush()
+		w.flushed = now
+	}
+	if w.err != nil {
+		slog.Error("Journal", "err", w.err)
+	}
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.gz.Close()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Join(w.err, err)
+}
+
+// Reader reads the frames of a journal in order.
+type Reader struct {
+	f   *os.File
+	gz  *gzip.Reader
+	dec *json.Decoder
+}
+
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Reader{f: f, gz: gz, dec: json.NewDecoder(gz)}, nil
+}
+
+// Next returns the next frame, or io.EOF after the last one. A journal cut
+// short by a crash ends at its last complete frame.
+func (r *Reader) Next() (Frame, error) {
+	var frame Frame
+	err := r.dec.Decode(&frame)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return frame, err
+}
+
+func (r *Reader) Close() error {
+	r.gz.Close()
+	return r.f.Close()
+}
+
+// Start returns the receive time of the first frame of stream.
+func Start(path, stream string) (time.Time, error) {
+	r, err := Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer r.Close()
+
+	for {
+		frame, err := r.Next()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if frame.Stream == stream {
+			return time.Unix(0, frame.Time), nil
+		}
+	}
+}
+
+// Replay passes the frames of stream to onFrame, waiting the recorded gap
+// between frames divided by speed. Speed 0 replays without waiting.
+func Replay(ctx context.Context, path, stream string, speed float64, onFrame func(Frame)) error {
+	r, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var prev int64
+	for ctx.Err() == nil {
+		frame, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if frame.Stream != stream {
+			continue
+		}
+
+		if speed > 0 && prev != 0 && frame.Time > prev {
+			t := time.NewTimer(time.Duration(float64(frame.Time-prev) / speed))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil
+			case <-t.C:
+			}
+		}
+		prev = frame.Time
+
+		onFrame(frame)
+	}
+
+	return nil
+}
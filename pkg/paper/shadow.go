@@ -0,0 +1,277 @@
+package paper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mm/pkg/alpha"
+	"os"
+	"strings"
+	"sync"
+)
+
+const defaultShadowEvery = 60
+
+// Shadow trades on a real venue and replays every quote through a
+// PaperEngine on the same feed, to measure how far the simulation drifts
+// from what the exchange actually fills.
+//
+// Both books start from the real inventory, bought at the first bar's close,
+// and keep PnL in quote currency, fees included.
+type Shadow struct {
+	alpha.Venue
+	sim    *Venue
+	every  int
+	limits DriftLimits
+
+	mu         sync.Mutex
+	seeded     bool
+	bars       int
+	close      float64
+	realInv    float64
+	realCash   float64
+	real, simd sideStats
+	maxInvDiff float64
+}
+
+// DriftLimits are the thresholds above which a drift report flags a
+// breach. Zero disables a check.
+type DriftLimits struct {
+	InvDiff  float64 // base quantity between real and simulated inventory
+	FillDiff float64 // relative difference of filled quantity
+	PxBps    float64 // average fill price difference per side
+	PnLDiff  float64 // PnL difference
+}
+
+type sideStats struct {
+	buyQty, sellQty     float64
+	buyValue, sellValue float64
+}
+
+func (s *sideStats) add(t alpha.Trade) {
+	if t.Side == "buy" {
+		s.buyQty += t.Size
+		s.buyValue += t.Price * t.Size
+	} else {
+		s.sellQty += t.Size
+		s.sellValue += t.Price * t.Size
+	}
+}
+
+func (s *sideStats) avg() (buy, sell float64) {
+	buy, sell = math.NaN(), math.NaN()
+	if s.buyQty > 0 {
+		buy = s.buyValue / s.buyQty
+	}
+	if s.sellQty > 0 {
+		sell = s.sellValue / s.sellQty
+	}
+	return buy, sell
+}
+
+// OrdersSent passes on the real venue's order request count, if it keeps
+// one, for the order rate limit.
+func (s *Shadow) OrdersSent() int64 {
+	if counter, ok := s.Venue.(interface{ OrdersSent() int64 }); ok {
+		return counter.OrdersSent()
+	}
+	return 0
+}
+
+func NewShadow(trader alpha.Venue, params *alpha.Params) *Shadow {
+	every := params.ShadowEvery
+	if every <= 0 {
+		every = defaultShadowEvery
+	}
+
+	return &Shadow{
+		Venue: trader,
+		sim:   NewVenue(trader, params, ""),
+		every: every,
+		limits: DriftLimits{
+			InvDiff:  params.ShadowMaxInvDiff,
+			FillDiff: params.ShadowMaxFillDiff,
+			PxBps:    params.ShadowMaxPxBps,
+			PnLDiff:  params.ShadowMaxPnLDiff,
+		},
+	}
+}
+
+func (s *Shadow) Engine() *alpha.PaperEngine {
+	return s.sim.Engine()
+}
+
+func (s *Shadow) FetchKlines(symbol, interval string, limit int, endTime string) ([]alpha.Candle, error) {
+	return s.sim.FetchKlines(symbol, interval, limit, endTime)
+}
+
+func (s *Shadow) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	s.sim.WsKline(ctx, symbol, interval, onTick)
+}
+
+// Fills passes the real executions on, booking them and the simulated ones
+// for the drift report.
+func (s *Shadow) Fills() []alpha.Trade {
+	fills := s.Venue.Fills()
+	simFills := s.sim.Fills()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range fills {
+		s.real.add(t)
+		notional := t.Price * t.Size
+		if t.Side == "buy" {
+			s.realInv += t.Size
+			s.realCash -= notional
+		} else {
+			s.realInv -= t.Size
+			s.realCash += notional
+		}
+		if t.FeeAsset == "" {
+			s.realCash -= t.Fee
+		}
+	}
+	for _, t := range simFills {
+		s.simd.add(t)
+	}
+
+	return fills
+}
+
+// Apply sends quote to the real venue and rests it in the simulation, then
+// reports the drift every so many bars.
+func (s *Shadow) Apply(quote alpha.Quote) error {
+	err := s.Venue.Apply(quote)
+
+	s.sim.mu.Lock()
+	closed := s.sim.closed
+	s.sim.mu.Unlock()
+
+	s.mu.Lock()
+	if !s.seeded && closed.Time == quote.Time {
+		inv := s.Venue.Inventory()
+		s.sim.mu.Lock()
+		s.sim.engine.Restore(alpha.PaperState{Inventory: inv, Cash: -inv * closed.Close})
+		s.sim.mu.Unlock()
+		s.realInv = inv
+		s.realCash = -inv * closed.Close
+		s.seeded = true
+	}
+	s.mu.Unlock()
+
+	if simErr := s.sim.Apply(quote); simErr != nil {
+		slog.Error("Shadow", "err", simErr)
+	}
+
+	s.mu.Lock()
+	s.bars++
+	s.close = closed.Close
+	s.maxInvDiff = max(s.maxInvDiff, math.Abs(s.Venue.Inventory()-s.sim.Inventory()))
+	due := s.bars%s.every == 0
+	s.mu.Unlock()
+
+	if due {
+		d := s.Drift()
+		d.Print(os.Stdout)
+		for _, b := range d.Breaches {
+			slog.Warn("Shadow", "drift", b)
+		}
+	}
+
+	return err
+}
+
+func (s *Shadow) Cancel() error {
+	if err := s.sim.Cancel(); err != nil {
+		slog.Error("Shadow", "err", err)
+	}
+	return s.Venue.Cancel()
+}
+
+func (s *Shadow) Flatten() error {
+	if err := s.sim.Flatten(); err != nil {
+		slog.Error("Shadow", "err", err)
+	}
+	return s.Venue.Flatten()
+}
+
+type Drift struct {
+	Bars                  int
+	RealBuys, RealSells   float64 // base quantity
+	SimBuys, SimSells     float64
+	RealBuyPx, RealSellPx float64 // NaN without fills
+	SimBuyPx, SimSellPx   float64
+	RealInv, SimInv       float64
+	MaxInvDiff            float64
+	RealPnL, SimPnL       float64
+	Breaches              []string
+}
+
+// Drift compares the real and simulated books so far.
+func (s *Shadow) Drift() Drift {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := Drift{
+		Bars:       s.bars,
+		RealBuys:   s.real.buyQty,
+		RealSells:  s.real.sellQty,
+		SimBuys:    s.simd.buyQty,
+		SimSells:   s.simd.sellQty,
+		RealInv:    s.Venue.Inventory(),
+		SimInv:     s.sim.Inventory(),
+		MaxInvDiff: s.maxInvDiff,
+		RealPnL:    s.realCash + s.realInv*s.close,
+	}
+	d.RealBuyPx, d.RealSellPx = s.real.avg()
+	d.SimBuyPx, d.SimSellPx = s.simd.avg()
+	s.sim.mu.Lock()
+	_, d.SimPnL = s.sim.engine.FinalPnL()
+	s.sim.mu.Unlock()
+
+	if s.limits.InvDiff > 0 && math.Abs(d.RealInv-d.SimInv) > s.limits.InvDiff {
+		d.Breaches = append(d.Breaches, fmt.Sprintf("inventory %g real vs %g simulated", d.RealInv, d.SimInv))
+	}
+	if s.limits.FillDiff > 0 {
+		realQty, simQty := d.RealBuys+d.RealSells, d.SimBuys+d.SimSells
+		if top := max(realQty, simQty); top > 0 && math.Abs(realQty-simQty)/top > s.limits.FillDiff {
+			d.Breaches = append(d.Breaches, fmt.Sprintf("filled %g real vs %g simulated", realQty, simQty))
+		}
+	}
+	if s.limits.PxBps > 0 {
+		if bps := pxBps(d.RealBuyPx, d.SimBuyPx); bps > s.limits.PxBps {
+			d.Breaches = append(d.Breaches, fmt.Sprintf("buy price off by %.1f bps", bps))
+		}
+		if bps := pxBps(d.RealSellPx, d.SimSellPx); bps > s.limits.PxBps {
+			d.Breaches = append(d.Breaches, fmt.Sprintf("sell price off by %.1f bps", bps))
+		}
+	}
+	if s.limits.PnLDiff > 0 && math.Abs(d.RealPnL-d.SimPnL) > s.limits.PnLDiff {
+		d.Breaches = append(d.Breaches, fmt.Sprintf("PnL %.2f real vs %.2f simulated", d.RealPnL, d.SimPnL))
+	}
+
+	return d
+}
+
+func (d Drift) Print(w io.Writer) {
+	fmt.Fprintf(w, "Shadow after %d bars (real / simulated):\n", d.Bars)
+	fmt.Fprintf(w, "  Filled qty:   buy %g / %g, sell %g / %g\n", d.RealBuys, d.SimBuys, d.RealSells, d.SimSells)
+	fmt.Fprintf(w, "  Avg price:    buy %.4f / %.4f, sell %.4f / %.4f\n", d.RealBuyPx, d.SimBuyPx, d.RealSellPx, d.SimSellPx)
+	fmt.Fprintf(w, "  Inventory:    %g / %g, max gap %g\n", d.RealInv, d.SimInv, d.MaxInvDiff)
+	fmt.Fprintf(w, "  PnL:          %.4f / %.4f\n", d.RealPnL, d.SimPnL)
+	if len(d.Breaches) > 0 {
+		fmt.Fprintf(w, "  DRIFT:        %s\n", strings.Join(d.Breaches, "; "))
+	}
+}
+
+// pxBps is the difference of two average prices in basis points, zero if
+// either side has no fills.
+func pxBps(realPx, simPx float64) float64 {
+	if math.IsNaN(realPx) || math.IsNaN(simPx) {
+		return 0
+	}
+	return math.Abs(realPx-simPx) / realPx * 1e4
+}
@@ -0,0 +1,185 @@
+// Package paper trades a PaperEngine on a real venue's live feed.
+package paper
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mm/pkg/alpha"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Venue takes market data from feed and fills quotes in a PaperEngine, so
+// the live loop can run without keys or risk. Each bar is filled against the
+// quotes resting while it traded, once the next bar starts. The engine state
+// is saved to statePath, if set, after every change and restored by Sync.
+type Venue struct {
+	feed      alpha.Venue
+	engine    *alpha.PaperEngine
+	statePath string
+
+	mu       sync.Mutex
+	last     alpha.Candle // bar in progress
+	closed   alpha.Candle // last finished bar
+	barFills []alpha.Trade
+	fills    []alpha.Trade
+}
+
+func NewVenue(feed alpha.Venue, params *alpha.Params, statePath string) *Venue {
+	return &Venue{
+		feed:      feed,
+		engine:    alpha.NewPaperEngine(params),
+		statePath: statePath,
+	}
+}
+
+func (v *Venue) Engine() *alpha.PaperEngine {
+	return v.engine
+}
+
+// FetchKlines also remembers the newest bar, the one the live loop quotes
+// on first.
+func (v *Venue) FetchKlines(symbol, interval string, limit int, endTime string) ([]alpha.Candle, error) {
+	candles, err := v.feed.FetchKlines(symbol, interval, limit, endTime)
+	if err != nil || len(candles) == 0 {
+		return candles, err
+	}
+
+	v.mu.Lock()
+	if c := candles[len(candles)-1]; c.Time >= v.last.Time {
+		v.last = c
+	}
+	v.mu.Unlock()
+
+	return candles, nil
+}
+
+func (v *Venue) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	v.feed.WsKline(ctx, symbol, interval, func(c alpha.Candle) {
+		v.tick(c)
+		onTick(c)
+	})
+}
+
+// tick fills the bar that just finished before the live loop sees the
+// next one.
+func (v *Venue) tick(c alpha.Candle) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.last.Time != 0 && c.Time > v.last.Time {
+		v.closed = v.last
+		v.barFills = v.engine.ApplyFills(v.closed)
+		v.fills = append(v.fills, v.barFills...)
+	}
+	v.last = c
+}
+
+// Sync restores the engine from statePath, if saved before.
+func (v *Venue) Sync(ctx context.Context, symbol string) error {
+	if v.statePath == "" {
+		return nil
+	}
+
+	f, err := os.Open(v.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var state alpha.PaperState
+	if err := gob.NewDecoder(f).Decode(&state); err != nil {
+		return fmt.Errorf("paper: %s: %w", v.statePath, err)
+	}
+
+	v.mu.Lock()
+	v.engine.Restore(state)
+	v.mu.Unlock()
+
+	slog.Info("Paper", "restored", v.statePath, "inventory", state.Inventory, "trades", len(state.Trades))
+	return nil
+}
+
+func (v *Venue) Wait() {}
+
+func (v *Venue) Inventory() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.engine.Inventory()
+}
+
+func (v *Venue) Fills() []alpha.Trade {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fills := v.fills
+	v.fills = nil
+	return fills
+}
+
+// Apply books the finished bar with its fills and rests quote for the next.
+func (v *Venue) Apply(quote alpha.Quote) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.closed.Time != quote.Time {
+		slog.Warn("Paper", "skip quote", quote.Time, "closed bar", v.closed.Time)
+		return nil
+	}
+
+	row := v.engine.FinalizeCandle(v.closed, quote, v.barFills)
+	v.barFills = nil
+	slog.Info("Paper", "inventory", row.Inventory, "pnl", row.CumulativePnL, "fees", row.Fees)
+	return v.save()
+}
+
+func (v *Venue) Cancel() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.engine.CancelAll()
+	return v.save()
+}
+
+func (v *Venue) Flatten() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if trade, ok := v.engine.Flatten(time.Now().UnixMilli()); ok {
+		v.fills = append(v.fills, trade)
+	}
+	return v.save()
+}
+
+func (v *Venue) save() error {
+	if v.statePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(v.statePath), 0o755); err != nil {
+		return err
+	}
+
+	tmp := v.statePath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(f).Encode(v.engine.State()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, v.statePath)
+}
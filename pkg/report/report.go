@@ -0,0 +1,225 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"mm/pkg/alpha"
+)
+
+const yearMillis = 365 * 24 * 60 * 60 * 1000
+
+// sizeEpsilon is the leftover size treated as fully matched.
+const sizeEpsilon = 1e-9
+
+type Report struct {
+	Bars     int
+	NetPnL   float64
+	GrossPnL float64
+	Fees     float64
+
+	Sharpe           float64
+	Sortino          float64
+	MaxDrawdown      float64
+	MaxDrawdownBars  int
+	MaxUnderwaterBar int
+
+	Trades       int
+	Turnover     float64
+	AvgInventory float64
+	MaxInventory float64
+
+	BidQuotes   int
+	AskQuotes   int
+	BuyFills    int
+	SellFills   int
+	BuyFillPct  float64
+	SellFillPct float64
+
+	RoundTrips    int
+	RoundTripQty  float64
+	SpreadCapture float64
+	CapturePerQty float64
+}
+
+func FromPaper(pe *alpha.PaperEngine, interval string) Report {
+	return New(pe.PnLHistory(), pe.Results(), pe.Trades(), interval)
+}
+
+func New(pnl []float64, results []alpha.ResultRow, trades []alpha.Trade, interval string) Report {
+	r := Report{
+		Bars:   len(pnl),
+		Trades: len(trades),
+	}
+
+	if n := len(results); n > 0 {
+		r.NetPnL = results[n-1].CumulativePnL
+		r.GrossPnL = results[n-1].GrossPnL
+		r.Fees = results[n-1].Fees
+	}
+
+	r.riskRatios(pnl, interval)
+	r.drawdown(pnl)
+	r.exposure(results)
+	r.fills(results, trades)
+	r.roundTrips(trades)
+
+	return r
+}
+
+// Ratios are computed on per-bar PnL changes, annualised for a market that
+// trades around the clock.
+func (r *Report) riskRatios(pnl []float64, interval string) {
+	if len(pnl) < 2 {
+		return
+	}
+
+	var sum, sumSq, downSq float64
+	n := float64(len(pnl) - 1)
+	for i := 1; i < len(pnl); i++ {
+		d := pnl[i] - pnl[i-1]
+		sum += d
+		sumSq += d * d
+		if d < 0 {
+			downSq += d * d
+		}
+	}
+
+	mean := sum / n
+	std := math.Sqrt(max(sumSq/n-mean*mean, 0))
+	downside := math.Sqrt(downSq / n)
+
+	scale := 1.0
+	if step := alpha.IntervalMillis(interval); step > 0 {
+		scale = math.Sqrt(float64(yearMillis / step))
+	}
+
+	if std > 0 {
+		r.Sharpe = mean / std * scale
+	}
+	if downside > 0 {
+		r.Sortino = mean / downside * scale
+	}
+}
+
+func (r *Report) drawdown(pnl []float64) {
+	if len(pnl) == 0 {
+		return
+	}
+
+	peak := pnl[0]
+	peakBar := 0
+	for i, v := range pnl {
+		if v >= peak {
+			peak = v
+			peakBar = i
+			continue
+		}
+
+		if dd := peak - v; dd > r.MaxDrawdown {
+			r.MaxDrawdown = dd
+			r.MaxDrawdownBars = i - peakBar
+		}
+		r.MaxUnderwaterBar = max(r.MaxUnderwaterBar, i-peakBar)
+	}
+}
+
+func (r *Report) exposure(results []alpha.ResultRow) {
+	if len(results) == 0 {
+		return
+	}
+
+	sum := 0.0
+	for _, row := range results {
+		inv := math.Abs(row.Inventory)
+		sum += inv
+		r.MaxInventory = max(r.MaxInventory, inv)
+	}
+	r.AvgInventory = sum / float64(len(results))
+}
+
+// A quote row places orders that can only fill on the following bar.
+func (r *Report) fills(results []alpha.ResultRow, trades []alpha.Trade) {
+	for _, row := range results {
+		if !math.IsNaN(row.Bid) {
+			r.BidQuotes++
+		}
+		if !math.IsNaN(row.Ask) {
+			r.AskQuotes++
+		}
+	}
+
+	for _, t := range trades {
+		r.Turnover += t.Price * t.Size
+		switch t.Side {
+		case "buy":
+			r.BuyFills++
+		case "sell":
+			r.SellFills++
+		}
+	}
+
+	if r.BidQuotes > 0 {
+		r.BuyFillPct = 100 * float64(r.BuyFills) / float64(r.BidQuotes)
+	}
+	if r.AskQuotes > 0 {
+		r.SellFillPct = 100 * float64(r.SellFills) / float64(r.AskQuotes)
+	}
+}
+
+type lot struct {
+	price float64
+	size  float64
+}
+
+// Round trips pair opening and closing fills first in, first out; the
+// capture is the price edge earned on the matched quantity before fees.
+func (r *Report) roundTrips(trades []alpha.Trade) {
+	var open []lot
+	long := true
+
+	for _, t := range trades {
+		isBuy := t.Side == "buy"
+		size := t.Size
+
+		for size > sizeEpsilon && len(open) > 0 && isBuy != long {
+			matched := min(size, open[0].size)
+			edge := t.Price - open[0].price
+			if isBuy {
+				edge = -edge
+			}
+
+			r.SpreadCapture += edge * matched
+			r.RoundTripQty += matched
+			r.RoundTrips++
+
+			size -= matched
+			open[0].size -= matched
+			if open[0].size <= sizeEpsilon {
+				open = open[1:]
+			}
+		}
+
+		if size > sizeEpsilon {
+			if len(open) == 0 {
+				long = isBuy
+			}
+			open = append(open, lot{price: t.Price, size: size})
+		}
+	}
+
+	if r.RoundTripQty > 0 {
+		r.CapturePerQty = r.SpreadCapture / r.RoundTripQty
+	}
+}
+
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Bars: %d\n", r.Bars)
+	fmt.Fprintf(w, "PnL: gross %.2f, fees %.2f, net %.2f\n", r.GrossPnL, r.Fees, r.NetPnL)
+	fmt.Fprintf(w, "Sharpe: %.2f, Sortino: %.2f\n", r.Sharpe, r.Sortino)
+	fmt.Fprintf(w, "Max drawdown: %.2f over %d bars, longest underwater %d bars\n", r.MaxDrawdown, r.MaxDrawdownBars, r.MaxUnderwaterBar)
+	fmt.Fprintf(w, "Trades: %d, turnover %.2f\n", r.Trades, r.Turnover)
+	fmt.Fprintf(w, "Inventory: avg |%.4f|, peak |%g|\n", r.AvgInventory, r.MaxInventory)
+	fmt.Fprintf(w, "Fills: buy %d/%d (%.1f%%), sell %d/%d (%.1f%%)\n", r.BuyFills, r.BidQuotes, r.BuyFillPct, r.SellFills, r.AskQuotes, r.SellFillPct)
+	fmt.Fprintf(w, "Round trips: %d, qty %g, spread capture %.2f (%.4f per unit)\n", r.RoundTrips, r.RoundTripQty, r.SpreadCapture, r.CapturePerQty)
+}
@@ -0,0 +1,56 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// serve exposes the guard on limits.Addr until ctx is done:
+//
+//	GET  /status  current Status as JSON
+//	POST /kill    halt quoting
+//	POST /reset   resume quoting
+func (g *Guard) serve(ctx context.Context) error {
+	ln, err := net.Listen("tcp", g.limits.Addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, g.Status())
+	})
+	mux.HandleFunc("POST /kill", func(w http.ResponseWriter, r *http.Request) {
+		if err := g.Kill("kill endpoint"); err != nil {
+			slog.Error("Risk", "err", err)
+		}
+		writeStatus(w, http.StatusOK, g.Status())
+	})
+	mux.HandleFunc("POST /reset", func(w http.ResponseWriter, r *http.Request) {
+		if err := g.Reset(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeStatus(w, http.StatusOK, g.Status())
+	})
+
+	srv := &http.Server{Handler: mux}
+	g.wg.Go(func() {
+		if err := srv.Serve(ln); err != http.ErrServerClosed {
+			slog.Error("Risk", "serve", err)
+		}
+	})
+	context.AfterFunc(ctx, func() { srv.Close() })
+
+	slog.Info("Risk", "listening", ln.Addr().String())
+	return nil
+}
+
+func writeStatus(w http.ResponseWriter, code int, s Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,385 @@
+// Package risk stops quoting when the session loses too much, carries too
+// much or is told to stop.
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"mm/pkg/alpha"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	killPollInterval = time.Second
+	orderRateWindow  = time.Minute
+)
+
+type Limits struct {
+	MaxDailyLoss float64 // equity lost since the UTC day started
+	MaxDrawdown  float64 // equity lost from its peak
+	MaxPosition  float64 // absolute position in base units
+	MaxNotional  float64 // absolute position times price
+	MaxOrderRate int     // orders placed, amended or cancelled per minute
+	Flatten      bool    // close the position on a breach
+	KillFile     string  // halt while this file exists
+	Addr         string  // serve /status, /kill and /reset here
+}
+
+func LimitsFrom(params *alpha.Params) Limits {
+	return Limits{
+		MaxDailyLoss: params.RiskMaxDailyLoss,
+		MaxDrawdown:  params.RiskMaxDrawdown,
+		MaxPosition:  params.RiskMaxPosition,
+		MaxNotional:  params.RiskMaxNotional,
+		MaxOrderRate: params.RiskMaxOrderRate,
+		Flatten:      params.RiskFlatten,
+		KillFile:     params.RiskKillFile,
+		Addr:         params.RiskAddr,
+	}
+}
+
+// Enabled reports whether any limit or kill switch is set.
+func (l Limits) Enabled() bool {
+	return l.MaxDailyLoss > 0 || l.MaxDrawdown > 0 || l.MaxPosition > 0 || l.MaxNotional > 0 ||
+		l.MaxOrderRate > 0 || l.KillFile != "" || l.Addr != ""
+}
+
+// Guard passes quotes on to a venue while every limit holds. Limits are
+// checked on every bar and before every quote. On the first breach it
+// cancels all orders, flattens if configured and drops quotes until Reset.
+//
+// Equity is marked to the last traded price, in quote currency, and starts
+// at zero with the opening position bought at the first price seen. Position
+// limits read the venue's own inventory, so fills the guard never saw still
+// count.
+type Guard struct {
+	alpha.Venue
+	limits Limits
+	wg     sync.WaitGroup
+
+	// sending is held while a quote is with the venue, so a halt cancels
+	// only after it has gone out
+	sending sync.Mutex
+
+	mu       sync.Mutex
+	halted   string // reason, empty while quoting
+	price    float64
+	cash     float64
+	inv      float64 // booked from fills, for equity only
+	marked   bool
+	peak     float64
+	day      time.Time
+	dayStart float64
+	orders   []time.Time
+}
+
+func New(venue alpha.Venue, params *alpha.Params) *Guard {
+	return &Guard{
+		Venue:  venue,
+		limits: LimitsFrom(params),
+	}
+}
+
+// Status is a snapshot of the guard.
+type Status struct {
+	Halted   bool    `json:"halted"`
+	Reason   string  `json:"reason,omitempty"`
+	Equity   float64 `json:"equity"`
+	Peak     float64 `json:"peak"`
+	DayStart float64 `json:"dayStart"`
+	Position float64 `json:"position"`
+	Price    float64 `json:"price"`
+}
+
+func (g *Guard) Status() Status {
+	position := g.Venue.Inventory()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return Status{
+		Halted:   g.halted != "",
+		Reason:   g.halted,
+		Equity:   g.equity(),
+		Peak:     g.peak,
+		DayStart: g.dayStart,
+		Position: position,
+		Price:    g.price,
+	}
+}
+
+// Sync starts the venue, then watches the kill file and serves the control
+// endpoint until ctx is done.
+func (g *Guard) Sync(ctx context.Context, symbol string) error {
+	if err := g.Venue.Sync(ctx, symbol); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.inv = g.Venue.Inventory()
+	g.mu.Unlock()
+
+	if g.limits.KillFile != "" {
+		g.wg.Go(func() { g.watchKillFile(ctx) })
+	}
+	if g.limits.Addr != "" {
+		if err := g.serve(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Guard) Wait() {
+	g.Venue.Wait()
+	g.wg.Wait()
+}
+
+func (g *Guard) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	g.Venue.WsKline(ctx, symbol, interval, func(c alpha.Candle) {
+		inv := g.Venue.Inventory()
+
+		g.mu.Lock()
+		g.mark(c.Close)
+		reason := ""
+		if g.halted == "" {
+			reason = g.check(time.Now(), inv, alpha.Quote{})
+			g.halted = reason
+		}
+		g.mu.Unlock()
+
+		if reason != "" {
+			if err := g.halt(reason); err != nil {
+				slog.Error("Risk", "err", err)
+			}
+		}
+		onTick(c)
+	})
+}
+
+// Fills books the venue's executions into the guard's equity.
+func (g *Guard) Fills() []alpha.Trade {
+	fills := g.Venue.Fills()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, t := range fills {
+		notional := t.Price * t.Size
+		if t.Side == "buy" {
+			g.inv += t.Size
+			g.cash -= notional
+		} else {
+			g.inv -= t.Size
+			g.cash += notional
+		}
+		// Fees paid in another asset, e.g. BNB, do not draw on the quote cash
+		if t.FeeAsset == "" {
+			g.cash -= t.Fee
+		}
+	}
+
+	return fills
+}
+
+// Apply checks every limit and forwards quote only if none is breached.
+func (g *Guard) Apply(quote alpha.Quote) error {
+	inv := g.Venue.Inventory()
+
+	g.sending.Lock()
+	g.mu.Lock()
+	if g.halted != "" {
+		g.mu.Unlock()
+		g.sending.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	if reason := g.check(now, inv, quote); reason != "" {
+		g.halted = reason
+		g.mu.Unlock()
+		g.sending.Unlock()
+		return g.halt(reason)
+	}
+	g.mu.Unlock()
+
+	before, counted := g.ordersSent()
+	err := g.Venue.Apply(quote)
+	after, _ := g.ordersSent()
+	g.sending.Unlock()
+
+	// Venues that cannot count their requests are charged one per leg
+	n := int(after - before)
+	if !counted {
+		n = 0
+		if quote.BidActive {
+			n++
+		}
+		if quote.AskActive {
+			n++
+		}
+	}
+
+	g.mu.Lock()
+	for range n {
+		g.orders = append(g.orders, now)
+	}
+	g.mu.Unlock()
+
+	return err
+}
+
+// ordersSent reads the venue's order request counter, if it keeps one.
+func (g *Guard) ordersSent() (int64, bool) {
+	counter, ok := g.Venue.(interface{ OrdersSent() int64 })
+	if !ok {
+		return 0, false
+	}
+	return counter.OrdersSent(), true
+}
+
+// Kill halts quoting by hand.
+func (g *Guard) Kill(reason string) error {
+	g.mu.Lock()
+	if g.halted != "" {
+		g.mu.Unlock()
+		return nil
+	}
+	g.halted = reason
+	g.mu.Unlock()
+
+	return g.halt(reason)
+}
+
+// Reset resumes quoting with the drawdown measured from the current equity.
+// The daily loss still counts from the start of the day, and a kill file
+// must be removed first.
+func (g *Guard) Reset() error {
+	if g.killFileExists() {
+		return fmt.Errorf("risk: kill file %s present", g.limits.KillFile)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.halted != "" {
+		slog.Info("Risk", "reset", g.halted)
+	}
+	g.halted = ""
+	g.peak = g.equity()
+	g.orders = g.orders[:0]
+	return nil
+}
+
+// mark moves the equity to price, tracking its peak and daily start.
+func (g *Guard) mark(price float64) {
+	g.price = price
+	if !g.marked {
+		g.cash -= g.inv * price
+		g.peak = g.equity()
+		g.marked = true
+	}
+
+	equity := g.equity()
+	g.peak = math.Max(g.peak, equity)
+	if day := time.Now().UTC().Truncate(24 * time.Hour); !day.Equal(g.day) {
+		g.day = day
+		g.dayStart = equity
+	}
+}
+
+func (g *Guard) equity() float64 {
+	return g.cash + g.inv*g.price
+}
+
+// check returns the first limit breached by placing quote with the venue
+// holding inv. The position counts the quote as filled on the side that
+// grows it. Pass an empty quote to check the current state only.
+func (g *Guard) check(now time.Time, inv float64, quote alpha.Quote) string {
+	l := g.limits
+	equity := g.equity()
+
+	long, short := inv, inv
+	if quote.BidActive {
+		long += quote.BidSize
+	}
+	if quote.AskActive {
+		short -= quote.AskSize
+	}
+	position := math.Max(math.Abs(long), math.Abs(short))
+
+	cutoff := now.Add(-orderRateWindow)
+	for len(g.orders) > 0 && g.orders[0].Before(cutoff) {
+		g.orders = g.orders[1:]
+	}
+
+	switch {
+	case g.marked && l.MaxDailyLoss > 0 && g.dayStart-equity > l.MaxDailyLoss:
+		return fmt.Sprintf("daily loss %.2f over %.2f", g.dayStart-equity, l.MaxDailyLoss)
+	case g.marked && l.MaxDrawdown > 0 && g.peak-equity > l.MaxDrawdown:
+		return fmt.Sprintf("drawdown %.2f over %.2f", g.peak-equity, l.MaxDrawdown)
+	case l.MaxPosition > 0 && position > l.MaxPosition:
+		return fmt.Sprintf("position %g over %g", position, l.MaxPosition)
+	case l.MaxNotional > 0 && position*g.price > l.MaxNotional:
+		return fmt.Sprintf("notional %.2f over %.2f", position*g.price, l.MaxNotional)
+	case l.MaxOrderRate > 0 && len(g.orders) > l.MaxOrderRate:
+		return fmt.Sprintf("%d orders in a minute over %d", len(g.orders), l.MaxOrderRate)
+	}
+
+	return ""
+}
+
+// halt pulls every order and optionally flattens once the caller has set
+// g.halted. Quoting stays blocked even if that fails. It runs without g.mu so
+// marking and the control endpoint are not held up by venue retries, but
+// waits for a quote still being sent.
+func (g *Guard) halt(reason string) error {
+	slog.Error("Risk", "halt", reason)
+
+	g.sending.Lock()
+	defer g.sending.Unlock()
+
+	var errs []error
+	if err := g.Venue.Cancel(); err != nil {
+		errs = append(errs, err)
+	}
+	if g.limits.Flatten {
+		if err := g.Venue.Flatten(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (g *Guard) killFileExists() bool {
+	if g.limits.KillFile == "" {
+		return false
+	}
+	_, err := os.Stat(g.limits.KillFile)
+	return err == nil
+}
+
+func (g *Guard) watchKillFile(ctx context.Context) {
+	ticker := time.NewTicker(killPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if g.killFileExists() {
+				if err := g.Kill("kill file " + g.limits.KillFile); err != nil {
+					slog.Error("Risk", "err", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package risk
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mm/pkg/alpha"
+)
+
+// stubVenue holds a position set by the test and counts what the guard
+// forwards. Each Apply sends perApply orders. Cancel blocks until release
+// is closed, if set.
+type stubVenue struct {
+	alpha.Venue
+	inv       atomic.Value
+	applied   atomic.Int32
+	cancelled atomic.Int32
+	sent      atomic.Int64
+	perApply  int64
+	release   chan struct{}
+}
+
+func newStub(inv float64) *stubVenue {
+	v := &stubVenue{}
+	v.inv.Store(inv)
+	return v
+}
+
+func (v *stubVenue) Sync(ctx context.Context, symbol string) error { return nil }
+func (v *stubVenue) Inventory() float64                            { return v.inv.Load().(float64) }
+func (v *stubVenue) Fills() []alpha.Trade                          { return nil }
+func (v *stubVenue) Flatten() error                                { return nil }
+
+func (v *stubVenue) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	onTick(alpha.Candle{Close: 100})
+}
+
+func (v *stubVenue) Apply(quote alpha.Quote) error {
+	v.applied.Add(1)
+	v.sent.Add(v.perApply)
+	return nil
+}
+
+func (v *stubVenue) OrdersSent() int64 { return v.sent.Load() }
+
+func (v *stubVenue) Cancel() error {
+	if v.release != nil {
+		<-v.release
+	}
+	v.cancelled.Add(1)
+	return nil
+}
+
+func TestGuardPosition(t *testing.T) {
+	bid := alpha.Quote{BidActive: true, BidSize: 0.4, AskActive: true, AskSize: 0.4}
+
+	tests := []struct {
+		name   string
+		inv    float64
+		quote  alpha.Quote
+		halted bool
+	}{
+		{"within", 0.5, bid, false},
+		{"bid grows long past limit", 0.7, bid, true},
+		{"ask grows short past limit", -0.7, bid, true},
+		{"ask reduces long", 0.7, alpha.Quote{AskActive: true, AskSize: 0.4}, false},
+		{"already over", 1.1, alpha.Quote{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			venue := newStub(0)
+			g := New(venue, &alpha.Params{RiskMaxPosition: 1})
+			if err := g.Sync(context.Background(), "BTCUSDT"); err != nil {
+				t.Fatal(err)
+			}
+
+			// The position moves without a fill reaching the guard
+			venue.inv.Store(tt.inv)
+			g.Apply(tt.quote)
+
+			if got := g.Status().Halted; got != tt.halted {
+				t.Errorf("halted %v, want %v", got, tt.halted)
+			}
+			if got, want := venue.applied.Load() == 1, !tt.halted; got != want {
+				t.Errorf("quote forwarded %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestGuardHaltsOnBar moves the position past the limit between quotes.
+func TestGuardHaltsOnBar(t *testing.T) {
+	venue := newStub(0)
+	g := New(venue, &alpha.Params{RiskMaxPosition: 1})
+
+	venue.inv.Store(1.5)
+	g.WsKline(context.Background(), "", "", func(alpha.Candle) {})
+
+	if !g.Status().Halted || venue.cancelled.Load() != 1 {
+		t.Errorf("halted %v with %d cancels after a bar over the limit", g.Status().Halted, venue.cancelled.Load())
+	}
+}
+
+// TestGuardOrderRate counts the orders the venue sends, so requotes that
+// leave the book alone do not use up the rate.
+func TestGuardOrderRate(t *testing.T) {
+	quote := alpha.Quote{BidActive: true, BidSize: 0.1, AskActive: true, AskSize: 0.1}
+
+	tests := []struct {
+		name     string
+		perApply int64
+		halted   bool
+	}{
+		{"book unchanged", 0, false},
+		{"cancel and replace both legs", 4, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			venue := newStub(0)
+			venue.perApply = tt.perApply
+			g := New(venue, &alpha.Params{RiskMaxOrderRate: 10})
+
+			for range 5 {
+				g.Apply(quote)
+			}
+			if got := g.Status().Halted; got != tt.halted {
+				t.Errorf("halted %v after 5 quotes, want %v", got, tt.halted)
+			}
+		})
+	}
+}
+
+func TestGuardHaltUnlocked(t *testing.T) {
+	venue := newStub(0)
+	venue.release = make(chan struct{})
+	g := New(venue, &alpha.Params{RiskMaxPosition: 1})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Kill("test")
+	}()
+
+	// Status and marking must not wait for the venue to cancel
+	halted := make(chan struct{})
+	go func() {
+		defer close(halted)
+		for !g.Status().Halted {
+			time.Sleep(time.Millisecond)
+		}
+		g.WsKline(context.Background(), "", "", func(alpha.Candle) {})
+	}()
+	select {
+	case <-halted:
+	case <-time.After(time.Second):
+		t.Fatal("guard blocked while cancelling")
+	}
+
+	close(venue.release)
+	<-done
+}
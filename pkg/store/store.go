@@ -0,0 +1,262 @@
+package store
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mm/pkg/alpha"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var header = []string{"time", "open", "high", "low", "close", "volume"}
+
+type Store struct {
+	Dir string
+}
+
+func New(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) Path(venue, symbol, interval string) string {
+	if venue == "" {
+		venue = "bn"
+	}
+	return filepath.Join(s.Dir, fmt.Sprintf("%s_%s_%s.csv", venue, symbol, interval))
+}
+
+// Fill tops up the cached series so it holds at least limit bars up to
+// endTime, downloading only the missing head and tail, and returns them.
+// A window with holes is downloaded again, and is an error if the venue
+// cannot close them.
+func (s *Store) Fill(venue alpha.Venue, venueName, symbol, interval string, limit int, endTime string) ([]alpha.Candle, error) {
+	path := s.Path(venueName, symbol, interval)
+	cached, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseEnd(endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	step := alpha.IntervalMillis(interval)
+	if step == 0 {
+		return nil, fmt.Errorf("store: unknown interval %q", interval)
+	}
+
+	candles := cached
+	if len(candles) == 0 {
+		if candles, err = venue.FetchKlines(symbol, interval, limit, endTime); err != nil {
+			return nil, err
+		}
+	} else {
+		last := candles[len(candles)-1].Time
+		if last <= end {
+			missing := min(int((end-last)/step)+1, limit)
+			tail, err := venue.FetchKlines(symbol, interval, missing, endTime)
+			if err != nil {
+				return nil, err
+			}
+			candles = alpha.MergeCandles(candles, tail)
+		}
+
+		have := len(Window(candles, limit, end))
+		if have < limit {
+			before := time.UnixMilli(min(candles[0].Time-1, end)).UTC().Format(time.RFC3339)
+			head, err := venue.FetchKlines(symbol, interval, limit-have, before)
+			if err != nil {
+				return nil, err
+			}
+			candles = alpha.MergeCandles(head, candles)
+		}
+	}
+
+	window := Window(candles, limit, end)
+	if len(cached) > 0 && Gap(window, step, end) != "" {
+		fresh, err := venue.FetchKlines(symbol, interval, limit, endTime)
+		if err != nil {
+			return nil, err
+		}
+		candles = alpha.MergeCandles(candles, fresh)
+		window = Window(candles, limit, end)
+	}
+
+	if len(candles) > 0 {
+		if err := Save(path, candles); err != nil {
+			return nil, err
+		}
+	}
+
+	if gap := Gap(window, step, end); gap != "" {
+		return nil, fmt.Errorf("store: %s %s: %s", symbol, interval, gap)
+	}
+	return window, nil
+}
+
+// Read returns the cached window without touching the network.
+func (s *Store) Read(venueName, symbol, interval string, limit int, endTime string) ([]alpha.Candle, error) {
+	candles, err := Load(s.Path(venueName, symbol, interval))
+	if err != nil {
+		return nil, err
+	}
+
+	return Select(candles, limit, endTime)
+}
+
+// Select is Window with an RFC3339 end time, empty meaning now. A limit of
+// zero or less keeps every bar up to the end.
+func Select(candles []alpha.Candle, limit int, endTime string) ([]alpha.Candle, error) {
+	end, err := parseEnd(endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = len(candles)
+	}
+
+	return Window(candles, limit, end), nil
+}
+
+// Window returns the last limit bars opened at or before end.
+func Window(candles []alpha.Candle, limit int, end int64) []alpha.Candle {
+	n := len(candles)
+	for n > 0 && candles[n-1].Time > end {
+		n--
+	}
+
+	return candles[max(0, n-limit):n]
+}
+
+// Gap describes the first bar of step missing from candles, between two
+// bars or after the last one, that had closed by end. It is empty for a
+// complete series.
+func Gap(candles []alpha.Candle, step, end int64) string {
+	for i := 1; i < len(candles); i++ {
+		if candles[i].Time-candles[i-1].Time >= 2*step {
+			return fmt.Sprintf("bars missing between %s and %s", formatMillis(candles[i-1].Time), formatMillis(candles[i].Time))
+		}
+	}
+	if n := len(candles); n > 0 && end-candles[n-1].Time >= 2*step {
+		return fmt.Sprintf("bars missing after %s", formatMillis(candles[n-1].Time))
+	}
+
+	return ""
+}
+
+func formatMillis(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
+
+func Load(path string) ([]alpha.Candle, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = len(header)
+	r.ReuseRecord = true
+
+	candles := make([]alpha.Candle, 0, 1024)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("store: %s: %w", path, err)
+		}
+		if record[0] == header[0] {
+			continue
+		}
+
+		c, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("store: %s: %w", path, err)
+		}
+		candles = append(candles, c)
+	}
+
+	return alpha.MergeCandles(nil, candles), nil
+}
+
+func Save(path string, candles []alpha.Candle) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	w.Write(header)
+	record := make([]string, len(header))
+	for _, c := range candles {
+		record[0] = strconv.FormatInt(c.Time, 10)
+		record[1] = strconv.FormatFloat(c.Open, 'f', -1, 64)
+		record[2] = strconv.FormatFloat(c.High, 'f', -1, 64)
+		record[3] = strconv.FormatFloat(c.Low, 'f', -1, 64)
+		record[4] = strconv.FormatFloat(c.Close, 'f', -1, 64)
+		record[5] = strconv.FormatFloat(c.Volume, 'f', -1, 64)
+		w.Write(record)
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func parseRecord(record []string) (alpha.Candle, error) {
+	var (
+		c   alpha.Candle
+		err error
+	)
+
+	if c.Time, err = strconv.ParseInt(record[0], 10, 64); err != nil {
+		return c, err
+	}
+
+	fields := []*float64{&c.Open, &c.High, &c.Low, &c.Close, &c.Volume}
+	for i, field := range fields {
+		if *field, err = strconv.ParseFloat(record[i+1], 64); err != nil {
+			return c, err
+		}
+	}
+
+	return c, nil
+}
+
+func parseEnd(endTime string) (int64, error) {
+	if endTime == "" {
+		return time.Now().UnixMilli(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, endTime)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.UnixMilli(), nil
+}
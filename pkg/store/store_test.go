@@ -0,0 +1,109 @@
+package store
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mm/pkg/alpha"
+)
+
+const step = 60_000
+
+// history is a fake venue serving bars, recording the limit of each fetch.
+type history struct {
+	alpha.Venue
+	bars   []alpha.Candle
+	limits []int
+}
+
+func (h *history) FetchKlines(symbol, interval string, limit int, endTime string) ([]alpha.Candle, error) {
+	h.limits = append(h.limits, limit)
+	end, err := parseEnd(endTime)
+	if err != nil {
+		return nil, err
+	}
+	return Window(h.bars, limit, end), nil
+}
+
+func bars(from int64, n int) []alpha.Candle {
+	candles := make([]alpha.Candle, n)
+	for i := range candles {
+		candles[i] = alpha.Candle{Time: from + int64(i)*step, Close: 100}
+	}
+	return candles
+}
+
+func drop(candles []alpha.Candle, i int) []alpha.Candle {
+	return append(append([]alpha.Candle(nil), candles[:i]...), candles[i+1:]...)
+}
+
+func TestFill(t *testing.T) {
+	const start = 1_700_000_000_000
+	all := bars(start, 1000)
+	end := all[len(all)-1].Time
+	endTime := time.UnixMilli(end).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		cached []alpha.Candle
+		venue  []alpha.Candle
+		err    string
+		limits []int
+	}{
+		{"empty cache", nil, all, "", []int{10}},
+		{"up to date", all[980:], all, "", []int{1}},
+		{"stale cache fetches at most limit", all[:20], all, "", []int{10}},
+		{"hole in cache is fetched again", drop(all[980:], 15), all, "", []int{1, 10}},
+		{"hole at the venue", nil, drop(all, 995), "missing between", []int{10}},
+		{"venue behind end", nil, all[:990], "missing after", []int{10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(t.TempDir())
+			if tt.cached != nil {
+				if err := Save(s.Path("bn", "BTCUSDT", "1m"), tt.cached); err != nil {
+					t.Fatal(err)
+				}
+			}
+			venue := &history{bars: tt.venue}
+
+			got, err := s.Fill(venue, "bn", "BTCUSDT", "1m", 10, endTime)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Fill error %v, want %q", err, tt.err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Fill: %v", err)
+				}
+				if len(got) != 10 || got[9].Time != end || Gap(got, step, end) != "" {
+					t.Errorf("Fill returned %d bars ending %d, want 10 contiguous ending %d", len(got), got[len(got)-1].Time, end)
+				}
+			}
+			if !slices.Equal(venue.limits, tt.limits) {
+				t.Errorf("fetched %v bars, want %v", venue.limits, tt.limits)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bn_BTCUSDT_1m.csv")
+	want := bars(1_700_000_000_000, 3)
+	want[1].Volume = 1.5
+
+	if err := Save(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || got[1] != want[1] {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+}
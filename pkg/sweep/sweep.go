@@ -0,0 +1,210 @@
+package sweep
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"mm/pkg/alpha"
+	"mm/pkg/report"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Range struct {
+	Field  string
+	Values []float64
+}
+
+// ParseRange accepts "field=from:to:step" or "field=v1,v2,...", field being
+// the JSON name of a numeric alpha.Params field.
+func ParseRange(spec string) (Range, error) {
+	name, values, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Range{}, fmt.Errorf("sweep: %q is not field=values", spec)
+	}
+
+	r := Range{Field: strings.TrimSpace(name)}
+	if _, err := field(&alpha.Params{}, r.Field); err != nil {
+		return Range{}, err
+	}
+
+	if parts := strings.Split(values, ":"); len(parts) == 3 {
+		bounds := make([]float64, 3)
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return Range{}, fmt.Errorf("sweep: %s: %w", r.Field, err)
+			}
+			bounds[i] = v
+		}
+
+		from, to, step := bounds[0], bounds[1], bounds[2]
+		if step <= 0 || to < from {
+			return Range{}, fmt.Errorf("sweep: %s: bad range %s", r.Field, values)
+		}
+		for i := 0; ; i++ {
+			v := from + float64(i)*step
+			if v > to+step*1e-9 {
+				break
+			}
+			r.Values = append(r.Values, math.Round(v*1e9)/1e9)
+		}
+		return r, nil
+	}
+
+	for _, part := range strings.Split(values, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Range{}, fmt.Errorf("sweep: %s: %w", r.Field, err)
+		}
+		r.Values = append(r.Values, v)
+	}
+
+	return r, nil
+}
+
+type Result struct {
+	Values []float64
+	Params *alpha.Params
+	Report report.Report
+}
+
+// Run backtests every combination of ranges applied over base on the same
+// candles, spread across all CPU cores, ranked by net PnL.
+func Run(base *alpha.Params, candles []alpha.Candle, ranges []Range) ([]Result, error) {
+	combos := [][]float64{{}}
+	for _, r := range ranges {
+		next := make([][]float64, 0, len(combos)*len(r.Values))
+		for _, combo := range combos {
+			for _, v := range r.Values {
+				next = append(next, append(combo[:len(combo):len(combo)], v))
+			}
+		}
+		combos = next
+	}
+
+	results := make([]Result, len(combos))
+	for i, combo := range combos {
+		params := *base
+		for j, r := range ranges {
+			if err := Set(&params, r.Field, combo[j]); err != nil {
+				return nil, err
+			}
+		}
+		results[i] = Result{Values: combo, Params: &params}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i].Report = Backtest(results[i].Params, candles)
+			}
+		}()
+	}
+	for i := range results {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Report.NetPnL > results[j].Report.NetPnL
+	})
+
+	return results, nil
+}
+
+func Backtest(params *alpha.Params, candles []alpha.Candle) report.Report {
+	strategy := alpha.NewMmStrat(params)
+	paper := alpha.NewPaperEngine(params)
+	alpha.Backtest(strategy, paper, candles, nil)
+	return report.FromPaper(paper, params.Interval)
+}
+
+func WriteCSV(w io.Writer, ranges []Range, results []Result) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"rank"}
+	for _, r := range ranges {
+		header = append(header, r.Field)
+	}
+	header = append(header, "netPnL", "grossPnL", "fees", "sharpe", "sortino", "maxDrawdown",
+		"trades", "buyFills", "sellFills", "avgInventory", "maxInventory")
+	cw.Write(header)
+
+	for i, res := range results {
+		rep := res.Report
+		record := []string{strconv.Itoa(i + 1)}
+		for _, v := range res.Values {
+			record = append(record, formatFloat(v))
+		}
+		record = append(record,
+			formatFloat(rep.NetPnL),
+			formatFloat(rep.GrossPnL),
+			formatFloat(rep.Fees),
+			formatFloat(rep.Sharpe),
+			formatFloat(rep.Sortino),
+			formatFloat(rep.MaxDrawdown),
+			strconv.Itoa(rep.Trades),
+			strconv.Itoa(rep.BuyFills),
+			strconv.Itoa(rep.SellFills),
+			formatFloat(rep.AvgInventory),
+			formatFloat(rep.MaxInventory),
+		)
+		cw.Write(record)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Set assigns v to the numeric Params field with the given JSON name,
+// truncating for integer fields.
+func Set(params *alpha.Params, name string, v float64) error {
+	f, err := field(params, name)
+	if err != nil {
+		return err
+	}
+
+	switch f.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f.SetFloat(v)
+	default:
+		f.SetInt(int64(v))
+	}
+
+	return nil
+}
+
+func field(params *alpha.Params, name string) (reflect.Value, error) {
+	rv := reflect.ValueOf(params).Elem()
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		sf := rt.Field(i)
+		tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if tag != name && sf.Name != name {
+			continue
+		}
+
+		switch sf.Type.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+			return rv.Field(i), nil
+		}
+		return reflect.Value{}, fmt.Errorf("sweep: %s is not numeric", name)
+	}
+
+	return reflect.Value{}, fmt.Errorf("sweep: unknown param %q", name)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
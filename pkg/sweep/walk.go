@@ -0,0 +1,157 @@
+package sweep
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"mm/pkg/alpha"
+	"mm/pkg/report"
+	"strconv"
+)
+
+type Fold struct {
+	InStart   int64
+	OutStart  int64
+	OutEnd    int64
+	Values    []float64
+	InReport  report.Report
+	OutReport report.Report
+}
+
+type Stability struct {
+	Field   string
+	Mean    float64
+	StdDev  float64
+	Min     float64
+	Max     float64
+	Changes int
+}
+
+type WalkResult struct {
+	Folds     []Fold
+	Equity    []float64
+	Report    report.Report
+	Stability []Stability
+}
+
+// WalkForward optimises over inBars, trades the winner on the next outBars
+// and rolls forward by outBars. Out-of-sample strategies are warmed up on
+// the in-sample bars without trading so the indicators start primed.
+func WalkForward(base *alpha.Params, candles []alpha.Candle, ranges []Range, inBars, outBars int) (WalkResult, error) {
+	if inBars <= 0 || outBars <= 0 {
+		return WalkResult{}, fmt.Errorf("sweep: walk-forward windows must be positive")
+	}
+	if len(candles) < inBars+outBars {
+		return WalkResult{}, fmt.Errorf("sweep: %d bars is too short for %d+%d walk-forward", len(candles), inBars, outBars)
+	}
+
+	var (
+		wr     WalkResult
+		rows   []alpha.ResultRow
+		trades []alpha.Trade
+		offset float64
+		gross  float64
+		fees   float64
+	)
+	for start := 0; start+inBars+outBars <= len(candles); start += outBars {
+		inSample := candles[start : start+inBars]
+		outSample := candles[start+inBars : start+inBars+outBars]
+
+		results, err := Run(base, inSample, ranges)
+		if err != nil {
+			return WalkResult{}, err
+		}
+		best := results[0]
+
+		strategy := alpha.NewMmStrat(best.Params)
+		for _, c := range inSample {
+			strategy.Process(c, 0)
+		}
+		paper := alpha.NewPaperEngine(best.Params)
+		alpha.Backtest(strategy, paper, outSample, nil)
+
+		for _, pnl := range paper.PnLHistory() {
+			wr.Equity = append(wr.Equity, offset+pnl)
+		}
+		for _, row := range paper.Results() {
+			row.CumulativePnL += offset
+			row.GrossPnL += gross
+			row.Fees += fees
+			rows = append(rows, row)
+		}
+		trades = append(trades, paper.Trades()...)
+		if n := len(rows); n > 0 {
+			offset = rows[n-1].CumulativePnL
+			gross = rows[n-1].GrossPnL
+			fees = rows[n-1].Fees
+		}
+
+		wr.Folds = append(wr.Folds, Fold{
+			InStart:   inSample[0].Time,
+			OutStart:  outSample[0].Time,
+			OutEnd:    outSample[len(outSample)-1].Time,
+			Values:    best.Values,
+			InReport:  best.Report,
+			OutReport: report.FromPaper(paper, base.Interval),
+		})
+	}
+
+	wr.Report = report.New(wr.Equity, rows, trades, base.Interval)
+
+	for i, r := range ranges {
+		s := Stability{Field: r.Field, Min: math.Inf(1), Max: math.Inf(-1)}
+		var sum, sumSq float64
+		for j, fold := range wr.Folds {
+			v := fold.Values[i]
+			sum += v
+			sumSq += v * v
+			s.Min = min(s.Min, v)
+			s.Max = max(s.Max, v)
+			if j > 0 && v != wr.Folds[j-1].Values[i] {
+				s.Changes++
+			}
+		}
+		n := float64(len(wr.Folds))
+		s.Mean = sum / n
+		s.StdDev = math.Sqrt(max(sumSq/n-s.Mean*s.Mean, 0))
+		wr.Stability = append(wr.Stability, s)
+	}
+
+	return wr, nil
+}
+
+func WriteFoldsCSV(w io.Writer, ranges []Range, folds []Fold) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"fold", "inStart", "outStart", "outEnd"}
+	for _, r := range ranges {
+		header = append(header, r.Field)
+	}
+	header = append(header, "inNetPnL", "inSharpe", "outNetPnL", "outSharpe", "outMaxDrawdown", "outTrades")
+	cw.Write(header)
+
+	for i, fold := range folds {
+		record := []string{
+			strconv.Itoa(i + 1),
+			strconv.FormatInt(fold.InStart, 10),
+			strconv.FormatInt(fold.OutStart, 10),
+			strconv.FormatInt(fold.OutEnd, 10),
+		}
+		for _, v := range fold.Values {
+			record = append(record, formatFloat(v))
+		}
+		record = append(record,
+			formatFloat(fold.InReport.NetPnL),
+			formatFloat(fold.InReport.Sharpe),
+			formatFloat(fold.OutReport.NetPnL),
+			formatFloat(fold.OutReport.Sharpe),
+			formatFloat(fold.OutReport.MaxDrawdown),
+			strconv.Itoa(fold.OutReport.Trades),
+		)
+		cw.Write(record)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
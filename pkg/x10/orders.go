@@ -0,0 +1,353 @@
+package x10
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"mm/pkg/alpha"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/tidwall/gjson"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	orderExpiry   = time.Hour
+	flattenSlip   = 0.05 // IOC limit past the mark price when flattening
+	maxSeenTrades = 1000
+)
+
+// market is the trading and settlement config of the traded market.
+type market struct {
+	qtyStep, pxStep float64
+	qtyPrec, pxPrec int
+
+	synthetic, collateral       *felt.Felt
+	syntheticRes, collateralRes int64
+
+	makerFee, takerFee string // rates as decimals, signed into the fee
+}
+
+// order is one limit order ready to be signed.
+type order struct {
+	side       string // BUY or SELL
+	qty, px    string
+	fee        string
+	postOnly   bool
+	reduceOnly bool
+	ioc        bool
+}
+
+// fillBook collects trades from the account stream until Fills drains them,
+// booking each trade id once.
+type fillBook struct {
+	mu        sync.Mutex
+	fills     []alpha.Trade
+	seen      map[int64]bool
+	seenOrder []int64
+}
+
+func (fb *fillBook) add(trade gjson.Result) {
+	id := trade.Get("id").Int()
+
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if fb.seen == nil {
+		fb.seen = make(map[int64]bool)
+	}
+	if fb.seen[id] {
+		return
+	}
+	fb.seen[id] = true
+	fb.seenOrder = append(fb.seenOrder, id)
+	if len(fb.seenOrder) > maxSeenTrades {
+		delete(fb.seen, fb.seenOrder[0])
+		fb.seenOrder = fb.seenOrder[1:]
+	}
+
+	side := "buy"
+	if trade.Get("side").Str == "SELL" {
+		side = "sell"
+	}
+	fb.fills = append(fb.fills, alpha.Trade{
+		Side:  side,
+		Time:  trade.Get("createdTime").Int(),
+		Price: trade.Get("price").Float(),
+		Size:  trade.Get("qty").Float(),
+		Fee:   trade.Get("fee").Float(),
+		Taker: trade.Get("isTaker").Bool(),
+	})
+}
+
+func (fb *fillBook) drain() []alpha.Trade {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fills := fb.fills
+	fb.fills = nil
+	return fills
+}
+
+// loadMarket reads the market's steps and l2Config and the account's fees.
+func (x *Extended) loadMarket() error {
+	body, err := x.get("GetMarket", "/api/v1/info/markets?market="+x.symbol)
+	if err != nil {
+		return err
+	}
+	info := gjson.GetBytes(body, "data.0")
+	if info.Get("name").Str != x.symbol {
+		return fmt.Errorf("x10: GetMarket: unknown market %s", x.symbol)
+	}
+
+	m := market{
+		qtyStep:       info.Get("tradingConfig.minOrderSizeChange").Float(),
+		pxStep:        info.Get("tradingConfig.minPriceChange").Float(),
+		qtyPrec:       decimals(info.Get("tradingConfig.minOrderSizeChange").Str),
+		pxPrec:        decimals(info.Get("tradingConfig.minPriceChange").Str),
+		syntheticRes:  info.Get("l2Config.syntheticResolution").Int(),
+		collateralRes: info.Get("l2Config.collateralResolution").Int(),
+	}
+	if m.synthetic, err = new(felt.Felt).SetString(info.Get("l2Config.syntheticId").Str); err != nil {
+		return fmt.Errorf("x10: GetMarket: syntheticId: %w", err)
+	}
+	if m.collateral, err = new(felt.Felt).SetString(info.Get("l2Config.collateralId").Str); err != nil {
+		return fmt.Errorf("x10: GetMarket: collateralId: %w", err)
+	}
+	if m.qtyStep <= 0 || m.pxStep <= 0 || m.syntheticRes <= 0 || m.collateralRes <= 0 {
+		return fmt.Errorf("x10: GetMarket: incomplete config for %s", x.symbol)
+	}
+
+	body, err = x.get("GetFees", "/api/v1/user/fees?market="+x.symbol)
+	if err != nil {
+		return err
+	}
+	fees := gjson.GetBytes(body, "data.0")
+	m.makerFee = fees.Get("makerFeeRate").Str
+	m.takerFee = fees.Get("takerFeeRate").Str
+	if m.makerFee == "" || m.takerFee == "" {
+		return fmt.Errorf("x10: GetFees: no fees for %s", x.symbol)
+	}
+
+	x.market = m
+	return nil
+}
+
+// loadAccount reads the sub-account's vault and checks the Stark key is
+// the one registered for it.
+func (x *Extended) loadAccount() error {
+	body, err := x.get("GetAccount", "/api/v1/user/account/info")
+	if err != nil {
+		return err
+	}
+
+	account := gjson.GetBytes(body, "data")
+	l2Key, err := new(felt.Felt).SetString(account.Get("l2Key").Str)
+	if err != nil {
+		return fmt.Errorf("x10: GetAccount: l2Key: %w", err)
+	}
+	if !l2Key.Equal(x.stark.pub) {
+		return fmt.Errorf("x10: %s is not the Stark key of account %s", x.profile.StarkKeyEnv, account.Get("accountId"))
+	}
+
+	x.vault = account.Get("l2Vault").Uint()
+	return nil
+}
+
+func (x *Extended) markPrice() (float64, error) {
+	body, err := x.get("GetMarkPrice", "/api/v1/info/markets/"+x.symbol+"/stats")
+	if err != nil {
+		return 0, err
+	}
+	px := gjson.GetBytes(body, "data.markPrice").Float()
+	if px <= 0 {
+		return 0, fmt.Errorf("x10: GetMarkPrice: no mark price for %s", x.symbol)
+	}
+	return px, nil
+}
+
+// quoteOrders rounds the active legs of quote onto the market's grid,
+// bids down and asks up so neither crosses further than asked.
+func (x *Extended) quoteOrders(quote alpha.Quote) []order {
+	m := x.market
+	var orders []order
+	if quote.BidActive {
+		if qty := math.Floor(quote.BidSize/m.qtyStep+1e-9) * m.qtyStep; qty > 0 {
+			orders = append(orders, order{
+				side:     "BUY",
+				qty:      strconv.FormatFloat(qty, 'f', m.qtyPrec, 64),
+				px:       strconv.FormatFloat(math.Floor(quote.BidPrice/m.pxStep+1e-9)*m.pxStep, 'f', m.pxPrec, 64),
+				fee:      m.makerFee,
+				postOnly: true,
+			})
+		}
+	}
+	if quote.AskActive {
+		if qty := math.Floor(quote.AskSize/m.qtyStep+1e-9) * m.qtyStep; qty > 0 {
+			orders = append(orders, order{
+				side:     "SELL",
+				qty:      strconv.FormatFloat(qty, 'f', m.qtyPrec, 64),
+				px:       strconv.FormatFloat(math.Ceil(quote.AskPrice/m.pxStep-1e-9)*m.pxStep, 'f', m.pxPrec, 64),
+				fee:      m.makerFee,
+				postOnly: true,
+			})
+		}
+	}
+	return orders
+}
+
+// flattenOrder closes pz with an IOC reduce-only limit flattenSlip past px,
+// which is how Extended takes market orders.
+func (x *Extended) flattenOrder(pz, px float64) order {
+	m := x.market
+	o := order{
+		qty:        strconv.FormatFloat(math.Round(math.Abs(pz)/m.qtyStep)*m.qtyStep, 'f', m.qtyPrec, 64),
+		fee:        m.takerFee,
+		reduceOnly: true,
+		ioc:        true,
+	}
+	if pz > 0 {
+		o.side = "SELL"
+		o.px = strconv.FormatFloat(math.Floor(px*(1-flattenSlip)/m.pxStep)*m.pxStep, 'f', m.pxPrec, 64)
+	} else {
+		o.side = "BUY"
+		o.px = strconv.FormatFloat(math.Ceil(px*(1+flattenSlip)/m.pxStep)*m.pxStep, 'f', m.pxPrec, 64)
+	}
+	return o
+}
+
+// settle works out the signed amounts of o: a buy gives collateral rounded
+// up, a sell receives it rounded down, and the fee always rounds up.
+func (x *Extended) settle(o order, expiry time.Time, nonce uint64) (*settlement, error) {
+	m := x.market
+	base, err := scaled(false, m.syntheticRes, o.qty)
+	if err != nil {
+		return nil, err
+	}
+	buy := o.side == "BUY"
+	quote, err := scaled(buy, m.collateralRes, o.qty, o.px)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := scaled(true, m.collateralRes, o.qty, o.px, o.fee)
+	if err != nil {
+		return nil, err
+	}
+
+	if buy {
+		quote = -quote
+	} else {
+		base = -base
+	}
+
+	return &settlement{
+		vault:       x.vault,
+		synthetic:   m.synthetic,
+		collateral:  m.collateral,
+		baseAmount:  base,
+		quoteAmount: quote,
+		fee:         uint64(fee),
+		expiry:      (expiry.UnixMilli()+999)/1000 + settlementExpiry,
+		nonce:       nonce,
+	}, nil
+}
+
+// placeOrder signs o and sends it.
+func (x *Extended) placeOrder(o order) error {
+	x.sent.Add(1)
+
+	expiry := time.Now().Add(orderExpiry)
+	nonce := uint64(rand.Uint32() >> 1)
+	s, err := x.settle(o, expiry, nonce)
+	if err != nil {
+		return err
+	}
+	r, sig, err := x.stark.sign(s, x.profile.ChainID)
+	if err != nil {
+		return fmt.Errorf("x10: PlaceOrder: sign: %w", err)
+	}
+
+	tif := "GTT"
+	if o.ioc {
+		tif = "IOC"
+	}
+	body, err := json.Marshal(map[string]any{
+		"id":                       strconv.FormatUint(rand.Uint64(), 36),
+		"market":                   x.symbol,
+		"type":                     "LIMIT",
+		"side":                     o.side,
+		"qty":                      o.qty,
+		"price":                    o.px,
+		"timeInForce":              tif,
+		"expiryEpochMillis":        expiry.UnixMilli(),
+		"fee":                      o.fee,
+		"nonce":                    strconv.FormatUint(nonce, 10),
+		"postOnly":                 o.postOnly,
+		"reduceOnly":               o.reduceOnly,
+		"selfTradeProtectionLevel": "ACCOUNT",
+		"settlement": map[string]any{
+			"signature":          map[string]string{"r": r.String(), "s": sig.String()},
+			"starkKey":           x.stark.pub.String(),
+			"collateralPosition": strconv.FormatUint(x.vault, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = x.post("PlaceOrder", "/api/v1/user/order", body)
+	return err
+}
+
+func (x *Extended) get(op, path string) ([]byte, error) {
+	return x.do(op, fasthttp.MethodGet, path, nil)
+}
+
+func (x *Extended) post(op, path string, body []byte) ([]byte, error) {
+	return x.do(op, fasthttp.MethodPost, path, body)
+}
+
+// do sends an authenticated request and returns the body of an OK reply.
+func (x *Extended) do(op, method, path string, body []byte) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.SetRequestURI(x.profile.Rest + path)
+	req.Header.Set("X-Api-Key", x.apiKey)
+	req.Header.SetMethod(method)
+	if body != nil {
+		req.Header.SetContentType("application/json")
+		req.SetBody(body)
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if err := x.client.Do(req, resp); err != nil {
+		return nil, fmt.Errorf("x10: %s: %w", op, err)
+	}
+
+	data := resp.Body()
+	if gjson.GetBytes(data, "status").Str != "OK" {
+		if msg := gjson.GetBytes(data, "error.message").Str; msg != "" {
+			return nil, fmt.Errorf("x10: %s: %s", op, msg)
+		}
+		return nil, fmt.Errorf("x10: %s: %d %s", op, resp.StatusCode(), data)
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+// decimals counts the digits after the point in a decimal step.
+func decimals(step string) int {
+	_, frac, ok := strings.Cut(step, ".")
+	if !ok {
+		return 0
+	}
+	return len(strings.TrimRight(frac, "0"))
+}
@@ -0,0 +1,245 @@
+package x10
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"mm/pkg/alpha"
+	"mm/pkg/journal"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/tidwall/gjson"
+	"github.com/valyala/fasthttp"
+)
+
+type Extended struct {
+	client  *fasthttp.Client
+	profile Profile
+	wg      sync.WaitGroup
+	apiKey  string
+	stark   *starkKey
+	vault   uint64
+
+	symbol   string
+	market   market
+	pz       atomic.Uint64 // float64 bits, written by the account stream
+	fills    fillBook
+	sent     atomic.Int64
+	recorder journal.Recorder
+}
+
+// NewExtended connects to the profile named in params, see LookupProfile.
+func NewExtended(params *alpha.Params) (*Extended, error) {
+	profile, err := LookupProfile(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Extended{
+		client:  &fasthttp.Client{},
+		profile: profile,
+	}, nil
+}
+
+func (x *Extended) Sync(ctx context.Context, symbol string) error {
+	x.symbol = symbol
+
+	x.apiKey = strings.TrimSpace(os.Getenv(x.profile.APIKeyEnv))
+	if x.apiKey == "" {
+		return errors.New("x10: " + x.profile.APIKeyEnv + " not set")
+	}
+
+	stark, err := parseStarkKey(os.Getenv(x.profile.StarkKeyEnv))
+	if err != nil {
+		return fmt.Errorf("x10: %s: %w", x.profile.StarkKeyEnv, err)
+	}
+	x.stark = stark
+
+	if err := x.loadAccount(); err != nil {
+		return err
+	}
+	if err := x.loadMarket(); err != nil {
+		return err
+	}
+
+	pz, err := x.getPz()
+	if err != nil {
+		return err
+	}
+	x.setPosition(pz)
+
+	x.wg.Go(func() { x.wsAccount(ctx) })
+
+	return nil
+}
+
+// SetRecorder passes r the candle and account stream messages as they
+// arrive, for -record.
+func (x *Extended) SetRecorder(r journal.Recorder) {
+	x.recorder = r
+}
+
+func (x *Extended) Profile() Profile {
+	return x.profile
+}
+
+func (x *Extended) Wait() {
+	x.wg.Wait()
+}
+
+// Fills returns the trades booked from the account stream since the last
+// call.
+func (x *Extended) Fills() []alpha.Trade {
+	return x.fills.drain()
+}
+
+// OrdersSent counts the order and mass cancel requests sent since the
+// venue was created.
+func (x *Extended) OrdersSent() int64 {
+	return x.sent.Load()
+}
+
+func (x *Extended) Inventory() float64 {
+	return x.position()
+}
+
+// Apply pulls the resting orders and signs and places the quote's active
+// legs as post-only limits. Extended has no batch placement, so the legs go
+// out one by one.
+func (x *Extended) Apply(quote alpha.Quote) error {
+	if err := x.cancelOrders(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, o := range x.quoteOrders(quote) {
+		if err := x.placeOrder(o); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (x *Extended) Cancel() error {
+	return x.cancelOrders()
+}
+
+func (x *Extended) Flatten() error {
+	pz, err := x.getPz()
+	if err != nil {
+		return err
+	}
+	x.setPosition(pz)
+	if math.Abs(pz) < x.market.qtyStep/2 {
+		return nil
+	}
+
+	px, err := x.markPrice()
+	if err != nil {
+		return err
+	}
+	return x.placeOrder(x.flattenOrder(pz, px))
+}
+
+func (x *Extended) position() float64 {
+	return math.Float64frombits(x.pz.Load())
+}
+
+func (x *Extended) setPosition(pz float64) {
+	x.pz.Store(math.Float64bits(pz))
+}
+
+func (x *Extended) cancelOrders() error {
+	x.sent.Add(1)
+	_, err := x.post("CancelOrders", "/api/v1/user/order/massCancel", []byte(`{"markets":["`+x.symbol+`"]}`))
+	return err
+}
+
+func (x *Extended) getPz() (float64, error) {
+	body, err := x.get("GetPz", "/api/v1/user/positions?market="+x.symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, position := range gjson.GetBytes(body, "data").Array() {
+		if position.Get("market").Str == x.symbol {
+			return positionSize(position), nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (x *Extended) wsAccount(ctx context.Context) {
+	header := http.Header{}
+	header.Set("X-Api-Key", x.apiKey)
+
+	for ctx.Err() == nil {
+		urlStr := x.profile.Stream + "/account"
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, urlStr, header)
+		if err != nil {
+			slog.Error("wsAccount", "Dial", err)
+			alpha.SleepCtx(ctx, 5*time.Second)
+			continue
+		}
+		stop := context.AfterFunc(ctx, func() { c.Close() })
+
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("wsAccount", "ReadMessage", err)
+				}
+				break
+			}
+
+			if x.recorder != nil {
+				x.recorder.Record("account", message)
+			}
+
+			switch gjson.GetBytes(message, "type").Str {
+			case "POSITION":
+				for _, position := range gjson.GetBytes(message, "data.positions").Array() {
+					if position.Get("market").Str == x.symbol {
+						x.setPosition(positionSize(position))
+						break
+					}
+				}
+			case "TRADE":
+				for _, trade := range gjson.GetBytes(message, "data.trades").Array() {
+					if trade.Get("market").Str == x.symbol {
+						x.fills.add(trade)
+					}
+				}
+			}
+		}
+
+		stop()
+		c.Close()
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Info("wsAccount", "disconnected", "reconnect in a sec")
+		alpha.SleepCtx(ctx, time.Second)
+	}
+}
+
+func positionSize(position gjson.Result) float64 {
+	size := position.Get("size").Float()
+	if position.Get("status").Str == "CLOSED" {
+		return 0
+	}
+	if position.Get("side").Str == "SHORT" {
+		return -size
+	}
+	return size
+}
@@ -0,0 +1,72 @@
+package x10
+
+import (
+	"fmt"
+	"mm/pkg/alpha"
+)
+
+// Profile is an Extended deployment, the Starknet chain its orders settle
+// on and the environment variables holding the sub-account's keys.
+type Profile struct {
+	Rest        string // REST API, without the /api/v1 path
+	Stream      string // stream API, e.g. wss://.../stream.extended.exchange/v1
+	ChainID     string // signed into every order, SN_MAIN or SN_SEPOLIA
+	APIKeyEnv   string
+	StarkKeyEnv string // Stark private key, hex
+}
+
+var Profiles = map[string]Profile{
+	"mainnet": {
+		Rest:        "https://api.starknet.extended.exchange",
+		Stream:      "wss://api.starknet.extended.exchange/stream.extended.exchange/v1",
+		ChainID:     "SN_MAIN",
+		APIKeyEnv:   "X10_API_KEY",
+		StarkKeyEnv: "X10_STARK_KEY",
+	},
+	"testnet": {
+		Rest:        "https://api.starknet.sepolia.extended.exchange",
+		Stream:      "wss://api.starknet.sepolia.extended.exchange/stream.extended.exchange/v1",
+		ChainID:     "SN_SEPOLIA",
+		APIKeyEnv:   "X10_TESTNET_API_KEY",
+		StarkKeyEnv: "X10_TESTNET_STARK_KEY",
+	},
+	// custom points at a self-hosted or mock server, signing for mainnet
+	"custom": {
+		ChainID:     "SN_MAIN",
+		APIKeyEnv:   "X10_API_KEY",
+		StarkKeyEnv: "X10_STARK_KEY",
+	},
+}
+
+// LookupProfile resolves params.Profile, mainnet when unset. restUrl,
+// streamUrl, apiKeyEnv and secretKeyEnv in params replace the profile's
+// own, secretKeyEnv naming the Stark key variable.
+func LookupProfile(params *alpha.Params) (Profile, error) {
+	name := params.Profile
+	if name == "" {
+		name = "mainnet"
+	}
+	p, ok := Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("x10: unknown profile %q", name)
+	}
+
+	if params.RestURL != "" {
+		p.Rest = params.RestURL
+	}
+	if params.StreamURL != "" {
+		p.Stream = params.StreamURL
+	}
+	if params.APIKeyEnv != "" {
+		p.APIKeyEnv = params.APIKeyEnv
+	}
+	if params.SecretKeyEnv != "" {
+		p.StarkKeyEnv = params.SecretKeyEnv
+	}
+
+	if p.Rest == "" || p.Stream == "" {
+		return Profile{}, fmt.Errorf("x10: profile %q needs restUrl and streamUrl", name)
+	}
+
+	return p, nil
+}
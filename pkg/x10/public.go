@@ -1,6 +1,7 @@
 package x10
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"mm/pkg/alpha"
@@ -13,38 +14,73 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
-func FetchKlines(symbol, interval string, limit int, endTime string) []alpha.Candle {
-	client := &fasthttp.Client{}
+const maxKlinesLimit = 1500
+
+func (x *Extended) FetchKlines(symbol, interval string, limit int, endTime string) ([]alpha.Candle, error) {
+	end := int64(0)
+	if endTime != "" {
+		t, err := time.Parse(time.RFC3339, endTime)
+		if err != nil {
+			return nil, err
+		}
+		end = t.UnixMilli()
+	}
+
+	// Page backwards from end until limit bars are collected or history runs out
+	candles := make([]alpha.Candle, 0, limit)
+	for len(candles) < limit {
+		page, err := x.fetchKlinesPage(symbol, interval, min(limit-len(candles), maxKlinesLimit), end)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		n := len(candles)
+		candles = alpha.MergeCandles(page, candles)
+		if len(candles) == n {
+			break
+		}
+		end = page[0].Time - 1
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	return candles, nil
+}
+
+func (x *Extended) fetchKlinesPage(symbol, interval string, limit int, end int64) ([]alpha.Candle, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	req.SetRequestURI(fmt.Sprintf("https://api.starknet.extended.exchange/api/v1/info/candles/%s/%s", symbol, "trades"))
+	req.SetRequestURI(fmt.Sprintf("%s/api/v1/info/candles/%s/%s", x.profile.Rest, symbol, "trades"))
 	req.Header.SetMethod(fasthttp.MethodGet)
 	queryArgs := req.URI().QueryArgs()
 	queryArgs.Set("symbol", symbol)
 	queryArgs.Set("interval", interval)
-	queryArgs.Set("limit", strconv.Itoa(min(limit, 1500)))
-	if endTime != "" {
-		t, err := time.Parse(time.RFC3339, endTime)
-		if err != nil {
-			panic(err)
-		}
-		queryArgs.Set("endTime", strconv.FormatInt(t.UnixMilli(), 10))
+	queryArgs.Set("limit", strconv.Itoa(limit))
+	if end > 0 {
+		queryArgs.Set("endTime", strconv.FormatInt(end, 10))
 	}
-	if err := client.Do(req, resp); err != nil {
-		panic(err)
+	if err := x.client.Do(req, resp); err != nil {
+		return nil, fmt.Errorf("x10: FetchKlines: %w", err)
 	}
 
 	jsonResult := gjson.GetBytes(resp.Body(), "data")
 	if !jsonResult.IsArray() {
-		panic("unexpected kline response format")
+		return nil, fmt.Errorf("x10: FetchKlines: unexpected kline response format")
 	}
 
-	candles := make([]alpha.Candle, limit)
-	n := limit - 1
-	for i, v := range jsonResult.Array() {
+	// Newest bar comes first
+	rows := jsonResult.Array()
+	candles := make([]alpha.Candle, len(rows))
+	n := len(rows) - 1
+	for i, v := range rows {
 		candles[n-i] = alpha.Candle{
 			Time:   v.Get("T").Int(),
 			Open:   v.Get("o").Float(),
@@ -55,46 +91,68 @@ func FetchKlines(symbol, interval string, limit int, endTime string) []alpha.Can
 		}
 	}
 
-	return candles
+	return candles, nil
 }
 
-func WsKline(symbol, interval string, onTick func(alpha.Candle)) {
-	wsURL := fmt.Sprintf("wss://api.starknet.extended.exchange/stream.extended.exchange/v1/candles/%s/%s?interval=PT%s", symbol, "trades", strings.ToUpper(interval))
+func (x *Extended) WsKline(ctx context.Context, symbol, interval string, onTick func(alpha.Candle)) {
+	wsURL := fmt.Sprintf("%s/candles/%s/%s?interval=PT%s", x.profile.Stream, symbol, "trades", strings.ToUpper(interval))
 
-	for {
-		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	for ctx.Err() == nil {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
 		if err != nil {
-			panic(err)
+			slog.Error("WsKline", "Dial", err)
+			alpha.SleepCtx(ctx, 5*time.Second)
+			continue
 		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
 
 		for {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
-				slog.Error("WsBbo", "WebSocket read error", err)
+				if ctx.Err() == nil {
+					slog.Error("WsBbo", "WebSocket read error", err)
+				}
 				conn.Close()
 				break
 			}
 
-			println(string(message))
-
-			data := gjson.GetBytes(message, "data")
-			if !data.IsArray() {
-				continue
+			if x.recorder != nil {
+				x.recorder.Record("kline", message)
+			}
+			if c, ok := ParseKline(message); ok {
+				onTick(c)
 			}
+		}
 
-			arr := data.Array()
-			k := arr[len(arr)-1]
-			onTick(alpha.Candle{
-				Time:   k.Get("T").Int(),
-				Open:   k.Get("o").Float(),
-				High:   k.Get("h").Float(),
-				Low:    k.Get("l").Float(),
-				Close:  k.Get("c").Float(),
-				Volume: k.Get("v").Float(),
-			})
+		stop()
+		if ctx.Err() != nil {
+			return
 		}
 
 		slog.Info("WsBbo", "disconnected", "reconnect in a sec")
-		time.Sleep(time.Second)
+		alpha.SleepCtx(ctx, time.Second)
+	}
+}
+
+// ParseKline reads the latest candle from a candles stream frame.
+func ParseKline(frame []byte) (alpha.Candle, bool) {
+	data := gjson.GetBytes(frame, "data")
+	if !data.IsArray() {
+		return alpha.Candle{}, false
 	}
+
+	arr := data.Array()
+	if len(arr) == 0 {
+		return alpha.Candle{}, false
+	}
+
+	k := arr[len(arr)-1]
+	return alpha.Candle{
+		Time:   k.Get("T").Int(),
+		Open:   k.Get("o").Float(),
+		High:   k.Get("h").Float(),
+		Low:    k.Get("l").Float(),
+		Close:  k.Get("c").Float(),
+		Volume: k.Get("v").Float(),
+	}, true
 }
@@ -0,0 +1,95 @@
+package x10
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/curve"
+)
+
+// TestTypeHashes derives the pinned type hashes from the contract's type
+// strings.
+func TestTypeHashes(t *testing.T) {
+	order := `"Order"("position_id":"felt","base_asset_id":"AssetId","base_amount":"i64","quote_asset_id":"AssetId","quote_amount":"i64","fee_asset_id":"AssetId","fee_amount":"u64","expiration":"Timestamp","salt":"felt")"PositionId"("value":"u32")"AssetId"("value":"felt")"Timestamp"("seconds":"u64")`
+	domain := `"StarknetDomain"("name":"shortstring","version":"shortstring","chainId":"shortstring","revision":"shortstring")`
+
+	if got := curve.StarknetKeccak([]byte(order)); !got.Equal(orderTypeHash) {
+		t.Errorf("order type hash %s, want %s", got, orderTypeHash)
+	}
+	if got := curve.StarknetKeccak([]byte(domain)); !got.Equal(domainTypeHash) {
+		t.Errorf("domain type hash %s, want %s", got, domainTypeHash)
+	}
+}
+
+// TestSettle checks the signed amounts of both sides round against the
+// account and the signature verifies under the account's key.
+func TestSettle(t *testing.T) {
+	key, err := parseStarkKey("0x7a7ff6fd3cab02ccdcd4a572563f5976f8976899b03a39773795a3c486d4986")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := &Extended{
+		profile: Profile{ChainID: "SN_SEPOLIA"},
+		stark:   key,
+		vault:   10002,
+		market: market{
+			synthetic:     mustFelt("0x4254432d3600000000000000000000"),
+			collateral:    mustFelt("0x31857064564ed0ff978e687456963cba09c2c6985d8f9300a1de4962fafa054"),
+			syntheticRes:  1_000_000,
+			collateralRes: 1_000_000,
+		},
+	}
+	expiry := time.UnixMilli(1_700_000_000_001)
+
+	tests := []struct {
+		side             string
+		base, quote, fee int64
+	}{
+		// 0.00123 * 43445.1 = 53.437473 exactly, fee 0.0133593682... rounds up
+		{"BUY", 1230, -53437473, 13360},
+		{"SELL", -1230, 53437473, 13360},
+	}
+	for _, tt := range tests {
+		o := order{side: tt.side, qty: "0.00123", px: "43445.1", fee: "0.00025"}
+		s, err := x.settle(o, expiry, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.baseAmount != tt.base || s.quoteAmount != tt.quote || s.fee != uint64(tt.fee) {
+			t.Errorf("%s settles %d/%d fee %d, want %d/%d fee %d", tt.side, s.baseAmount, s.quoteAmount, s.fee, tt.base, tt.quote, tt.fee)
+		}
+		if want := int64(1_700_000_001 + settlementExpiry); s.expiry != want {
+			t.Errorf("%s expiry %d, want %d", tt.side, s.expiry, want)
+		}
+
+		r, sig, err := key.sign(s, x.profile.ChainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		domain := curve.PoseidonArray(domainTypeHash, shortString("Perpetuals"), shortString("v0"), shortString("SN_SEPOLIA"), new(felt.Felt).SetUint64(1))
+		msg := curve.PoseidonArray(shortString("StarkNet Message"), domain, key.pub, s.hash())
+		if ok, err := curve.VerifyFelts(msg, r, sig, key.pub); !ok || err != nil {
+			t.Errorf("%s signature does not verify: %v", tt.side, err)
+		}
+	}
+}
+
+func TestScaled(t *testing.T) {
+	tests := []struct {
+		up      bool
+		factors []string
+		want    int64
+	}{
+		{false, []string{"0.1", "3"}, 300000},
+		{true, []string{"0.1", "3"}, 300000},
+		{false, []string{"0.0000015"}, 1},
+		{true, []string{"0.0000015"}, 2},
+	}
+	for _, tt := range tests {
+		got, err := scaled(tt.up, 1_000_000, tt.factors...)
+		if err != nil || got != tt.want {
+			t.Errorf("scaled(%v, %v) = %d, %v, want %d", tt.up, tt.factors, got, err, tt.want)
+		}
+	}
+}